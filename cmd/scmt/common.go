@@ -14,3 +14,9 @@ func GetString(cmd cobra.Command, name string) string {
 	}
 	return retv
 }
+
+func GetBool(cmd cobra.Command, name string) bool {
+	retv, _ := cmd.Flags().GetBool(name)
+	log.Debugf("%s returned %t", name, retv)
+	return retv
+}
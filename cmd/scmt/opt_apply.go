@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jvzantvoort/scmt/config"
+	"github.com/jvzantvoort/scmt/data"
+	"github.com/jvzantvoort/scmt/messages"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// ApplyCmd represents the apply command
+var ApplyCmd = &cobra.Command{
+	Use:   messages.GetUse("apply"),
+	Short: messages.GetShort("apply"),
+	Long:  messages.GetLong("apply"),
+	RunE:  handleApplyCmd,
+}
+
+// handleApplyCmd renders the templates of the assigned roles
+func handleApplyCmd(cmd *cobra.Command, args []string) error {
+	log.Debugf("%s: start", cmd.Use)
+	defer log.Debugf("%s: end", cmd.Use)
+
+	cfg := config.New()
+	d, err := data.New(*cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create data: %w", err)
+	}
+	if err := d.Open(); err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	// Rendering does not change the data, so the lock is not held
+	defer d.SendNotifications()
+
+	roles := d.ListRoles()
+	if len(args) > 0 {
+		for _, role := range args {
+			if !d.HasRole(role) {
+				return fmt.Errorf("role %s is not assigned", role)
+			}
+		}
+		roles = args
+	}
+
+	files, err := applyRoles(cfg, d, roles, Engineer, GetBool(*cmd, "force"))
+	if perr := printRoleFiles(files); perr != nil {
+		return perr
+	}
+	return err
+}
+
+func init() {
+	ApplyCmd.Flags().BoolP("force", "f", false, "Overwrite output files modified outside scmt")
+
+	rootCmd.AddCommand(ApplyCmd)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// setupRoleTemplates creates role template trees and a root directory for
+// the rendered files
+func setupRoleTemplates(t *testing.T, tmpDir string) string {
+	t.Helper()
+
+	rootDir := t.TempDir()
+	viper.Set("rootdir", rootDir)
+	t.Cleanup(func() { viper.Set("rootdir", "") })
+
+	writeTemplateFiles(t, filepath.Join(tmpDir, "roles"), map[string]string{
+		"web-server/templates/etc/nginx/nginx.conf": "owner {{.Config.OWNER}};\n",
+		"web-server/templates/etc/nginx/site.conf":  "{{if .HasRole \"database\"}}db{{else}}nodb{{end}}\n",
+		"web-server/templates/.git/HEAD":            "ignored",
+		"database/templates/etc/postgres/scmt.conf": "type = {{.Config.TYPE}}\n",
+	})
+	return rootDir
+}
+
+// writeHooks writes executable shell scripts into the hooks directory
+func writeHooks(t *testing.T, tmpDir string, hooks map[string]string) {
+	t.Helper()
+	hooksdir := filepath.Join(tmpDir, "hooks.d")
+	if err := os.MkdirAll(hooksdir, 0755); err != nil {
+		t.Fatalf("Failed to create hooks dir: %v", err)
+	}
+	for name, script := range hooks {
+		if err := os.WriteFile(filepath.Join(hooksdir, name), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+			t.Fatalf("Failed to write hook: %v", err)
+		}
+	}
+}
+
+func TestRoleAddCommand_RendersRoleTemplates(t *testing.T) {
+	tmpDir := setupTestEnvironment(t)
+	initializeTestData(t)
+	rootDir := setupRoleTemplates(t, tmpDir)
+
+	if err := roleAddCmd.RunE(roleAddCmd, []string{"web-server"}); err != nil {
+		t.Fatalf("Failed to add role: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(rootDir, "etc", "nginx", "nginx.conf"))
+	if err != nil {
+		t.Fatalf("Expected role template to be rendered: %v", err)
+	}
+	if string(content) != "owner Mad House;\n" {
+		t.Errorf("Unexpected rendered content %q", string(content))
+	}
+	if _, err := os.Stat(filepath.Join(rootDir, ".git")); !os.IsNotExist(err) {
+		t.Error("Hidden files in the role template tree should be ignored")
+	}
+	if _, err := os.Stat(filepath.Join(rootDir, "etc", "postgres")); !os.IsNotExist(err) {
+		t.Error("Templates of unassigned roles should not be rendered")
+	}
+}
+
+func TestApplyCommand_Integration(t *testing.T) {
+	tmpDir := setupTestEnvironment(t)
+	initializeTestData(t)
+	rootDir := setupRoleTemplates(t, tmpDir)
+
+	if err := roleAddCmd.RunE(roleAddCmd, []string{"web-server"}); err != nil {
+		t.Fatalf("Failed to add web-server role: %v", err)
+	}
+	if err := roleAddCmd.RunE(roleAddCmd, []string{"database"}); err != nil {
+		t.Fatalf("Failed to add database role: %v", err)
+	}
+
+	// The site was rendered before the database role existed
+	siteFile := filepath.Join(rootDir, "etc", "nginx", "site.conf")
+	content, _ := os.ReadFile(siteFile)
+	if string(content) != "nodb\n" {
+		t.Errorf("Expected site rendered without database, got %q", string(content))
+	}
+
+	if err := ApplyCmd.RunE(ApplyCmd, []string{}); err != nil {
+		t.Fatalf("Failed to apply roles: %v", err)
+	}
+	content, _ = os.ReadFile(siteFile)
+	if string(content) != "db\n" {
+		t.Errorf("Expected apply to re-render site with database, got %q", string(content))
+	}
+	if _, err := os.Stat(filepath.Join(rootDir, "etc", "postgres", "scmt.conf")); err != nil {
+		t.Errorf("Expected database template to be rendered: %v", err)
+	}
+
+	// A hand edited file stops apply until forced
+	if err := os.WriteFile(siteFile, []byte("edited\n"), 0644); err != nil {
+		t.Fatalf("Failed to modify rendered file: %v", err)
+	}
+	err := ApplyCmd.RunE(ApplyCmd, []string{"web-server"})
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 role templates failed") {
+		t.Errorf("Expected apply to refuse modified file, got: %v", err)
+	}
+
+	if err := ApplyCmd.RunE(ApplyCmd, []string{"cache"}); err == nil {
+		t.Error("Expected error when applying an unassigned role")
+	}
+}
+
+func TestRoleRemoveCommand_Purge(t *testing.T) {
+	tmpDir := setupTestEnvironment(t)
+	initializeTestData(t)
+	rootDir := setupRoleTemplates(t, tmpDir)
+
+	if err := roleAddCmd.RunE(roleAddCmd, []string{"web-server"}); err != nil {
+		t.Fatalf("Failed to add role: %v", err)
+	}
+
+	nginxFile := filepath.Join(rootDir, "etc", "nginx", "nginx.conf")
+	siteFile := filepath.Join(rootDir, "etc", "nginx", "site.conf")
+	if err := os.WriteFile(siteFile, []byte("edited\n"), 0644); err != nil {
+		t.Fatalf("Failed to modify rendered file: %v", err)
+	}
+
+	if err := roleRemoveCmd.Flags().Set("purge", "true"); err != nil {
+		t.Fatalf("Failed to set purge flag: %v", err)
+	}
+	defer func() { _ = roleRemoveCmd.Flags().Set("purge", "false") }()
+
+	if err := roleRemoveCmd.RunE(roleRemoveCmd, []string{"web-server"}); err != nil {
+		t.Fatalf("Failed to remove role: %v", err)
+	}
+
+	if _, err := os.Stat(nginxFile); !os.IsNotExist(err) {
+		t.Error("Expected rendered file to be purged")
+	}
+	if _, err := os.Stat(siteFile); err != nil {
+		t.Error("Expected modified file to be kept")
+	}
+
+	// Without --purge nothing is removed
+	if err := roleRemoveCmd.Flags().Set("purge", "false"); err != nil {
+		t.Fatalf("Failed to reset purge flag: %v", err)
+	}
+	if err := roleAddCmd.RunE(roleAddCmd, []string{"database"}); err != nil {
+		t.Fatalf("Failed to add role: %v", err)
+	}
+	if err := roleRemoveCmd.RunE(roleRemoveCmd, []string{"database"}); err != nil {
+		t.Fatalf("Failed to remove role: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(rootDir, "etc", "postgres", "scmt.conf")); err != nil {
+		t.Error("Expected rendered file to be kept without --purge")
+	}
+}
+
+func TestRoleRemoveCommand_PurgeHooks(t *testing.T) {
+	tmpDir := setupTestEnvironment(t)
+	initializeTestData(t)
+	rootDir := setupRoleTemplates(t, tmpDir)
+
+	if err := roleAddCmd.RunE(roleAddCmd, []string{"web-server"}); err != nil {
+		t.Fatalf("Failed to add role: %v", err)
+	}
+
+	// Removals run the hooks like every other change
+	nginxFile := filepath.Join(rootDir, "etc", "nginx", "nginx.conf")
+	siteFile := filepath.Join(rootDir, "etc", "nginx", "site.conf")
+	out := filepath.Join(t.TempDir(), "hooks.out")
+	writeHooks(t, tmpDir, map[string]string{
+		"pre-10-keep": "[ \"$SCMT_HOOK_OPTION:$SCMT_HOOK_OLD\" = \"TEMPLATE_REMOVE:" + nginxFile + "\" ] && exit 1\nexit 0\n",
+		"10-record":   "echo \"$SCMT_HOOK_OPTION $SCMT_HOOK_OLD\" >> " + out + "\n",
+	})
+
+	if err := roleRemoveCmd.Flags().Set("purge", "true"); err != nil {
+		t.Fatalf("Failed to set purge flag: %v", err)
+	}
+	defer func() { _ = roleRemoveCmd.Flags().Set("purge", "false") }()
+
+	if err := roleRemoveCmd.RunE(roleRemoveCmd, []string{"web-server"}); err != nil {
+		t.Fatalf("Failed to remove role: %v", err)
+	}
+
+	if _, err := os.Stat(nginxFile); err != nil {
+		t.Error("Expected the vetoed removal to keep the file")
+	}
+	if _, err := os.Stat(siteFile); !os.IsNotExist(err) {
+		t.Error("Expected the file to be purged")
+	}
+	content, _ := os.ReadFile(out)
+	if !strings.Contains(string(content), "TEMPLATE_REMOVE "+siteFile+"\n") || strings.Contains(string(content), "TEMPLATE_REMOVE "+nginxFile) {
+		t.Errorf("Expected the post hooks to see the removal of site.conf only, got %q", content)
+	}
+}
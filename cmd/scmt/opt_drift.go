@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/jvzantvoort/scmt/config"
+	"github.com/jvzantvoort/scmt/messages"
+	"github.com/jvzantvoort/scmt/state"
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// DriftResult reports the status of one rendered file
+type DriftResult struct {
+	Path     string `json:"path"`
+	Template string `json:"template"`
+	Status   string `json:"status"`
+	Engineer string `json:"engineer"`
+	Changed  string `json:"changed"`
+}
+
+// DriftCmd represents the drift command
+var DriftCmd = &cobra.Command{
+	Use:   messages.GetUse("drift"),
+	Short: messages.GetShort("drift"),
+	Long:  messages.GetLong("drift"),
+	Args:  cobra.NoArgs,
+	RunE:  handleDriftCmd,
+}
+
+// handleDriftCmd compares rendered files with their recorded checksums
+func handleDriftCmd(cmd *cobra.Command, args []string) error {
+	log.Debugf("%s: start", cmd.Use)
+	defer log.Debugf("%s: end", cmd.Use)
+
+	cfg := config.New()
+	st, err := state.New(cfg.Statefile)
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+
+	results := []DriftResult{}
+	drifted := 0
+	for _, entry := range st.Entries {
+		status, err := st.Check(entry.Path)
+		if err != nil {
+			return fmt.Errorf("failed to check %s for drift: %w", entry.Path, err)
+		}
+		if status != state.StatusOK {
+			drifted++
+		}
+		results = append(results, DriftResult{
+			Path:     entry.Path,
+			Template: entry.Template,
+			Status:   status,
+			Engineer: entry.Engineer,
+			Changed:  entry.Changed.Format("2006-01-02 15:04"),
+		})
+	}
+
+	if OutputJSON {
+		jsonBytes, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Println(string(jsonBytes))
+	} else {
+		table := tablewriter.NewWriter(os.Stdout)
+		table.Header([]string{"Path", "Status", "Template", "Engineer", "Changed"})
+		tabledata := [][]string{}
+		for _, result := range results {
+			tabledata = append(tabledata, []string{result.Path, result.Status, result.Template, result.Engineer, result.Changed})
+		}
+		if err := table.Bulk(tabledata); err != nil {
+			return err
+		}
+		if err := table.Render(); err != nil {
+			return err
+		}
+	}
+
+	if drifted > 0 {
+		return fmt.Errorf("%d of %d rendered files drifted from their templates", drifted, len(results))
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(DriftCmd)
+}
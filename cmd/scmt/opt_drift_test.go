@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDriftCommand_Integration(t *testing.T) {
+	setupTestEnvironment(t)
+	initializeTestData(t)
+
+	tmpDir := t.TempDir()
+	templateFile := filepath.Join(tmpDir, "drift.template")
+	outputFile := filepath.Join(tmpDir, "drift.conf")
+
+	err := os.WriteFile(templateFile, []byte("type = {{.Config.TYPE}}\n"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create template file: %v", err)
+	}
+
+	// Render and verify nothing drifted
+	if err := WriteCmd.RunE(WriteCmd, []string{templateFile, outputFile}); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	if err := DriftCmd.RunE(DriftCmd, []string{}); err != nil {
+		t.Fatalf("Expected no drift after render: %v", err)
+	}
+
+	// Rendering again over an unmodified file is allowed
+	if err := WriteCmd.RunE(WriteCmd, []string{templateFile, outputFile}); err != nil {
+		t.Fatalf("Failed to re-render unmodified file: %v", err)
+	}
+
+	// Hand edit the rendered file
+	if err := os.WriteFile(outputFile, []byte("type = edited\n"), 0644); err != nil {
+		t.Fatalf("Failed to modify output file: %v", err)
+	}
+
+	err = DriftCmd.RunE(DriftCmd, []string{})
+	if err == nil || !strings.Contains(err.Error(), "1 of 1 rendered files drifted") {
+		t.Errorf("Expected drift to be reported, got: %v", err)
+	}
+
+	err = WriteCmd.RunE(WriteCmd, []string{templateFile, outputFile})
+	if err == nil || !strings.Contains(err.Error(), "modified outside scmt") {
+		t.Fatalf("Expected write to refuse drifted file, got: %v", err)
+	}
+	content, _ := os.ReadFile(outputFile)
+	if string(content) != "type = edited\n" {
+		t.Errorf("Drifted file should not be overwritten, got %q", string(content))
+	}
+
+	// --force overwrites and records the new checksum
+	if err := WriteCmd.Flags().Set("force", "true"); err != nil {
+		t.Fatalf("Failed to set force flag: %v", err)
+	}
+	defer func() { _ = WriteCmd.Flags().Set("force", "false") }()
+
+	if err := WriteCmd.RunE(WriteCmd, []string{templateFile, outputFile}); err != nil {
+		t.Fatalf("Failed to force write: %v", err)
+	}
+	content, _ = os.ReadFile(outputFile)
+	if string(content) != "type = server\n" {
+		t.Errorf("Expected forced write to restore rendered content, got %q", string(content))
+	}
+	if err := DriftCmd.RunE(DriftCmd, []string{}); err != nil {
+		t.Errorf("Expected no drift after forced write: %v", err)
+	}
+}
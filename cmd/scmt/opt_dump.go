@@ -29,7 +29,15 @@ func handleDumpCmd(cmd *cobra.Command, args []string) {
 			log.Errorf("Failed to open data: %v", err)
 			return
 		}
-		if cfg.OutputJSON {
+		if GetBool(*cmd, "explain") {
+			outputtype := "table"
+			if cfg.OutputJSON {
+				outputtype = "json"
+			}
+			if err := scmto.Explain(outputtype, os.Stdout); err != nil {
+				log.Errorf("Failed to explain: %v", err)
+			}
+		} else if cfg.OutputJSON {
 			if err := scmto.Dumper("json", os.Stdout); err != nil {
 				log.Errorf("Failed to dump JSON: %v", err)
 			}
@@ -43,4 +51,6 @@ func handleDumpCmd(cmd *cobra.Command, args []string) {
 
 func init() {
 	rootCmd.AddCommand(DumpCmd)
+
+	DumpCmd.Flags().Bool("explain", false, "Show where each value came from")
 }
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/jvzantvoort/scmt/config"
+	"github.com/jvzantvoort/scmt/data"
+	"github.com/jvzantvoort/scmt/messages"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// execve replaces the scmt process, a variable so tests can intercept it
+var execve = syscall.Exec
+
+// ExecCmd represents the exec command
+var ExecCmd = &cobra.Command{
+	Use:   messages.GetUse("exec"),
+	Short: messages.GetShort("exec"),
+	Long:  messages.GetLong("exec"),
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  handleExecCmd,
+}
+
+// handleExecCmd runs a command with the configuration in its environment
+func handleExecCmd(cmd *cobra.Command, args []string) error {
+	log.Debugf("%s: start", cmd.Use)
+	defer log.Debugf("%s: end", cmd.Use)
+
+	only, _ := cmd.Flags().GetStringSlice("only")
+
+	cfg := config.New()
+
+	d, err := data.New(*cfg)
+	if err != nil {
+		return err
+	}
+	if err := d.Open(); err != nil {
+		return err
+	}
+
+	environ, err := d.Environ(GetString(*cmd, "prefix"), only)
+	if err != nil {
+		return err
+	}
+
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to find %s: %w", args[0], err)
+	}
+
+	log.Debugf("Executing %s with %d configuration variables", path, len(environ))
+	if err := execve(path, args, mergeEnviron(os.Environ(), environ)); err != nil {
+		return fmt.Errorf("failed to execute %s: %w", path, err)
+	}
+	return nil
+}
+
+// mergeEnviron returns base with the entries of overrides, which replace
+// entries of base with the same name
+func mergeEnviron(base, overrides []string) []string {
+	names := map[string]bool{}
+	for _, entry := range overrides {
+		name, _, _ := strings.Cut(entry, "=")
+		names[name] = true
+	}
+
+	retv := []string{}
+	for _, entry := range base {
+		name, _, _ := strings.Cut(entry, "=")
+		if !names[name] {
+			retv = append(retv, entry)
+		}
+	}
+	return append(retv, overrides...)
+}
+
+func init() {
+	rootCmd.AddCommand(ExecCmd)
+
+	ExecCmd.Flags().String("prefix", "", "Prefix for every variable name")
+	ExecCmd.Flags().StringSlice("only", []string{}, "Only expose these parameters (KEY1,KEY2)")
+
+	// Flags after the command belong to the command
+	ExecCmd.Flags().SetInterspersed(false)
+}
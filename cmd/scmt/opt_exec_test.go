@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExecCommand(t *testing.T) {
+	setupTestEnvironment(t)
+	initializeTestData(t)
+
+	var gotPath string
+	var gotArgs, gotEnv []string
+	originalExecve := execve
+	execve = func(path string, args []string, env []string) error {
+		gotPath, gotArgs, gotEnv = path, args, env
+		return nil
+	}
+	defer func() { execve = originalExecve }()
+
+	_ = ExecCmd.Flags().Set("prefix", "SCMT_")
+	defer func() { _ = ExecCmd.Flags().Set("prefix", "") }()
+
+	t.Setenv("SCMT_TYPE", "outer")
+	if err := ExecCmd.RunE(ExecCmd, []string{"sh", "-c", "true"}); err != nil {
+		t.Fatalf("Failed to exec: %v", err)
+	}
+	if !strings.HasSuffix(gotPath, "/sh") || strings.Join(gotArgs, " ") != "sh -c true" {
+		t.Errorf("Expected sh -c true, got %s %v", gotPath, gotArgs)
+	}
+
+	environ := strings.Join(gotEnv, "\n") + "\n"
+	if !strings.Contains(environ, "SCMT_TYPE=server\n") || strings.Contains(environ, "SCMT_TYPE=outer") {
+		t.Errorf("Expected SCMT_TYPE to be replaced by the configuration, got %v", gotEnv)
+	}
+	if !strings.Contains(environ, "SCMT_ROLES=\n") {
+		t.Errorf("Expected empty SCMT_ROLES, got %v", gotEnv)
+	}
+
+	if err := ExecCmd.RunE(ExecCmd, []string{"nonexistent-command-for-scmt"}); err == nil {
+		t.Error("Expected error for a missing command")
+	}
+}
+
+func TestMergeEnviron(t *testing.T) {
+	merged := mergeEnviron([]string{"PATH=/bin", "TYPE=old", "HOME=/root"}, []string{"TYPE=new"})
+	if strings.Join(merged, ";") != "PATH=/bin;HOME=/root;TYPE=new" {
+		t.Errorf("Expected TYPE to be replaced, got %v", merged)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jvzantvoort/scmt/config"
+	"github.com/jvzantvoort/scmt/data"
+	"github.com/jvzantvoort/scmt/messages"
+	"github.com/jvzantvoort/scmt/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// ExportCmd represents the export command
+var ExportCmd = &cobra.Command{
+	Use:   messages.GetUse("export"),
+	Short: messages.GetShort("export"),
+	Long:  messages.GetLong("export"),
+	Args:  cobra.NoArgs,
+	RunE:  handleExportCmd,
+}
+
+// handleExportCmd writes the effective configuration in another format
+func handleExportCmd(cmd *cobra.Command, args []string) error {
+	log.Debugf("%s: start", cmd.Use)
+	defer log.Debugf("%s: end", cmd.Use)
+
+	format := GetString(*cmd, "format")
+	if format == "" {
+		format = data.FormatEnv
+		if OutputJSON {
+			format = data.FormatJSON
+		}
+	}
+
+	cfg := config.New()
+
+	d, err := data.New(*cfg)
+	if err != nil {
+		return err
+	}
+	if err := d.Open(); err != nil {
+		return err
+	}
+
+	prefix := GetString(*cmd, "prefix")
+
+	if path := GetString(*cmd, "systemd-env"); path != "" {
+		var content bytes.Buffer
+		if err := d.Export(data.FormatSystemd, prefix, &content); err != nil {
+			return err
+		}
+		return writeExportFile(d, data.FormatSystemd, path, content.Bytes(), 0640, "SYSTEMD_ENV_WRITE")
+	}
+
+	// The audit log is not written to, its size is one of the metrics
+	if path := GetString(*cmd, "prometheus"); path != "" {
+		labels, _ := cmd.Flags().GetStringSlice("prometheus-labels")
+		var content bytes.Buffer
+		if err := d.Prometheus(labels, &content); err != nil {
+			return err
+		}
+		return writeExportFile(d, data.FormatPrometheus, path, content.Bytes(), 0644, "")
+	}
+
+	if GetBool(*cmd, "ansible-facts") {
+		path := GetString(*cmd, "ansible-facts-file")
+
+		// An executable fact is run by Ansible and always reports the
+		// current data
+		if GetBool(*cmd, "ansible-script") {
+			content, err := ansibleFactScript(cfg, prefix)
+			if err != nil {
+				return err
+			}
+			return writeExportFile(d, data.FormatAnsible, path, content, 0755, "ANSIBLE_FACTS_WRITE")
+		}
+
+		var content bytes.Buffer
+		if err := d.Export(data.FormatAnsible, prefix, &content); err != nil {
+			return err
+		}
+		return writeExportFile(d, data.FormatAnsible, path, content.Bytes(), 0644, "ANSIBLE_FACTS_WRITE")
+	}
+
+	return d.Export(format, prefix, os.Stdout)
+}
+
+// ansibleFactScript returns an executable Ansible fact running this scmt
+func ansibleFactScript(cfg *config.Config, prefix string) ([]byte, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the scmt executable: %w", err)
+	}
+
+	// Ansible runs the fact from its own working directory
+	configdir, err := filepath.Abs(cfg.Configdir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", cfg.Configdir, err)
+	}
+
+	command := []string{executable, "--configdir", configdir, "export", "--format", data.FormatAnsible}
+	if prefix != "" {
+		command = append(command, "--prefix", prefix)
+	}
+	for i, arg := range command {
+		command[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return []byte(fmt.Sprintf("#!/bin/sh\n# Generated by scmt, reports the scmt data as ansible_local.scmt\nexec %s\n", strings.Join(command, " "))), nil
+}
+
+// writeExportFile replaces path with content atomically and only when the
+// content changes. Unless option is empty each write is a change like a
+// template write: the pre- hooks may veto it, it is recorded in the audit
+// log as option and the post hooks and webhooks are notified.
+func writeExportFile(d *data.Data, format, path string, content []byte, perm os.FileMode, option string) error {
+	message := fmt.Sprintf("Export %s: %s", format, path)
+	if option != "" {
+		if current, err := os.ReadFile(path); err != nil || !bytes.Equal(current, content) {
+			if err := d.PreChange(option, "", path, Engineer, message); err != nil {
+				return err
+			}
+		}
+	}
+
+	written, err := utils.WriteFileAtomic(path, content, perm)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	if written && option != "" {
+		if err := d.LogChange(option, "", path, Engineer, message); err != nil {
+			log.Warnf("Failed to log export write: %v", err)
+		}
+		// The file is written, the write is committed. Exports do not
+		// change the data, so the lock is not held.
+		d.RunPostHooks()
+		d.SendNotifications()
+	}
+
+	if OutputJSON {
+		output := map[string]interface{}{
+			"action":  "export",
+			"format":  format,
+			"path":    path,
+			"changed": written,
+		}
+		jsonBytes, _ := json.MarshalIndent(output, "", "  ")
+		fmt.Println(string(jsonBytes))
+	} else if written {
+		fmt.Printf("Wrote %s\n", path)
+	} else {
+		fmt.Printf("%s is unchanged\n", path)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(ExportCmd)
+
+	ExportCmd.Flags().String("format", "", "Output format: env, shell, systemd, json, yaml, toml, ini, csv, markdown or ansible (default env)")
+	ExportCmd.Flags().StringP("prefix", "p", "", "Prefix for every exported key")
+	ExportCmd.Flags().String("systemd-env", "", "Write a systemd EnvironmentFile= to this path")
+	ExportCmd.Flags().String("prometheus", "", "Write a node_exporter textfile collector file to this path")
+	ExportCmd.Flags().StringSlice("prometheus-labels", []string{}, "Parameters to label scmt_info with (KEY1,KEY2)")
+	ExportCmd.Flags().Bool("ansible-facts", false, "Write the Ansible local facts file")
+	ExportCmd.Flags().String("ansible-facts-file", "/etc/ansible/facts.d/scmt.fact", "Path of the Ansible local facts file")
+	ExportCmd.Flags().Bool("ansible-script", false, "Write the Ansible local facts as executable script running scmt")
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jvzantvoort/scmt/config"
+	"github.com/jvzantvoort/scmt/data"
+	"github.com/jvzantvoort/scmt/logger"
+)
+
+func TestExportCommand_SystemdEnv(t *testing.T) {
+	tmpDir := setupTestEnvironment(t)
+	initializeTestData(t)
+
+	target := filepath.Join(tmpDir, "env", "app.env")
+	_ = ExportCmd.Flags().Set("systemd-env", target)
+	defer func() { _ = ExportCmd.Flags().Set("systemd-env", "") }()
+
+	// Writing twice only writes and logs once
+	for i := 0; i < 2; i++ {
+		if err := ExportCmd.RunE(ExportCmd, []string{}); err != nil {
+			t.Fatalf("Failed to export: %v", err)
+		}
+	}
+
+	content, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatalf("Failed to read environment file: %v", err)
+	}
+	if !strings.Contains(string(content), "OWNER=\"Mad House\"\n") {
+		t.Errorf("Expected quoted OWNER, got:\n%s", content)
+	}
+	if info, _ := os.Stat(target); info.Mode().Perm() != 0640 {
+		t.Errorf("Expected mode 0640, got %o", info.Mode().Perm())
+	}
+
+	countWrites := func() int {
+		records, err := logger.New(Logfile)
+		if err != nil {
+			t.Fatalf("Failed to create logger: %v", err)
+		}
+		if err := records.Open(); err != nil {
+			t.Fatalf("Failed to open log: %v", err)
+		}
+		count := 0
+		for _, record := range records.Records {
+			if record.Option == "SYSTEMD_ENV_WRITE" && record.Value == target {
+				count++
+			}
+		}
+		return count
+	}
+	if count := countWrites(); count != 1 {
+		t.Errorf("Expected 1 audit record, got %d", count)
+	}
+
+	// A changed configuration is written again
+	d, err := data.New(*config.New())
+	if err != nil {
+		t.Fatalf("Failed to create data: %v", err)
+	}
+	if err := d.Open(); err != nil {
+		t.Fatalf("Failed to open data: %v", err)
+	}
+	if err := d.SafeSet("OWNER", "DevOps", "testuser", "test"); err != nil {
+		t.Fatalf("Failed to set option: %v", err)
+	}
+	if err := ExportCmd.RunE(ExportCmd, []string{}); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	if count := countWrites(); count != 2 {
+		t.Errorf("Expected 2 audit records, got %d", count)
+	}
+}
+
+func TestExportCommand_Hooks(t *testing.T) {
+	tmpDir := setupTestEnvironment(t)
+	initializeTestData(t)
+
+	out := filepath.Join(t.TempDir(), "hooks.out")
+	writeHooks(t, tmpDir, map[string]string{
+		"pre-10-no-facts": "[ \"$SCMT_HOOK_OPTION\" = ANSIBLE_FACTS_WRITE ] && exit 1\nexit 0\n",
+		"10-record":       "echo \"$SCMT_HOOK_OPTION $SCMT_HOOK_NEW\" >> " + out + "\n",
+	})
+
+	// Export writes are changes like any other: hooks run and may veto them
+	target := filepath.Join(tmpDir, "env", "app.env")
+	_ = ExportCmd.Flags().Set("systemd-env", target)
+	if err := ExportCmd.RunE(ExportCmd, []string{}); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	_ = ExportCmd.Flags().Set("systemd-env", "")
+	content, _ := os.ReadFile(out)
+	if string(content) != "SYSTEMD_ENV_WRITE "+target+"\n" {
+		t.Errorf("Expected the post hooks to see the write, got %q", content)
+	}
+
+	factsFile := filepath.Join(tmpDir, "facts.d", "scmt.fact")
+	_ = ExportCmd.Flags().Set("ansible-facts", "true")
+	_ = ExportCmd.Flags().Set("ansible-facts-file", factsFile)
+	defer func() {
+		_ = ExportCmd.Flags().Set("ansible-facts", "false")
+		_ = ExportCmd.Flags().Set("ansible-facts-file", "/etc/ansible/facts.d/scmt.fact")
+	}()
+	if err := ExportCmd.RunE(ExportCmd, []string{}); err == nil {
+		t.Error("Expected the facts write to be vetoed")
+	}
+	if _, err := os.Stat(factsFile); !os.IsNotExist(err) {
+		t.Error("Expected no facts file after a veto")
+	}
+}
+
+func TestExportCommand_AnsibleFacts(t *testing.T) {
+	tmpDir := setupTestEnvironment(t)
+	initializeTestData(t)
+
+	target := filepath.Join(tmpDir, "facts.d", "scmt.fact")
+	flags := ExportCmd.Flags()
+	_ = flags.Set("ansible-facts", "true")
+	_ = flags.Set("ansible-facts-file", target)
+	defer func() {
+		_ = flags.Set("ansible-facts", "false")
+		_ = flags.Set("ansible-facts-file", "/etc/ansible/facts.d/scmt.fact")
+		_ = flags.Set("ansible-script", "false")
+	}()
+
+	if err := ExportCmd.RunE(ExportCmd, []string{}); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	content, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatalf("Failed to read facts: %v", err)
+	}
+	var facts data.AnsibleFacts
+	if err := json.Unmarshal(content, &facts); err != nil {
+		t.Fatalf("Failed to parse facts: %v", err)
+	}
+	if facts.Config["TYPE"] != "server" || facts.Metadata["TYPE"].Engineer != "testuser" {
+		t.Errorf("Expected TYPE with its metadata, got %+v", facts)
+	}
+
+	_ = flags.Set("ansible-script", "true")
+	if err := ExportCmd.RunE(ExportCmd, []string{}); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	content, _ = os.ReadFile(target)
+	if !strings.HasPrefix(string(content), "#!/bin/sh\n") || !strings.Contains(string(content), "'--format' 'ansible'") {
+		t.Errorf("Expected an executable fact script, got:\n%s", content)
+	}
+	if info, _ := os.Stat(target); info.Mode().Perm() != 0755 {
+		t.Errorf("Expected mode 0755, got %o", info.Mode().Perm())
+	}
+}
+
+func TestAnsibleFactScript_RelativeConfigdir(t *testing.T) {
+	script, err := ansibleFactScript(&config.Config{Configdir: "etc/scmt"}, "")
+	if err != nil {
+		t.Fatalf("Failed to create fact script: %v", err)
+	}
+	configdir, _ := filepath.Abs("etc/scmt")
+	if !strings.Contains(string(script), "'--configdir' '"+configdir+"'") {
+		t.Errorf("Expected the absolute configdir %s, got:\n%s", configdir, script)
+	}
+}
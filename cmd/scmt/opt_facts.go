@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+
+	"github.com/jvzantvoort/scmt/facts"
+	"github.com/jvzantvoort/scmt/messages"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// FactsCmd represents the facts command
+var FactsCmd = &cobra.Command{
+	Use:   messages.GetUse("facts"),
+	Short: messages.GetShort("facts"),
+	Long:  messages.GetLong("facts"),
+	Args:  cobra.NoArgs,
+	RunE:  handleFactsCmd,
+}
+
+// handleFactsCmd prints the facts gathered from the local host
+func handleFactsCmd(cmd *cobra.Command, args []string) error {
+	log.Debugf("%s: start", cmd.Use)
+	defer log.Debugf("%s: end", cmd.Use)
+
+	hostfacts := facts.Gather()
+	if OutputJSON {
+		return hostfacts.Dumper("json", os.Stdout)
+	}
+	return hostfacts.Dumper("table", os.Stdout)
+}
+
+func init() {
+	rootCmd.AddCommand(FactsCmd)
+}
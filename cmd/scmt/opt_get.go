@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/jvzantvoort/scmt/config"
+	"github.com/jvzantvoort/scmt/data"
+	"github.com/jvzantvoort/scmt/messages"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// GetCmd represents the get command
+var GetCmd = &cobra.Command{
+	Use:   messages.GetUse("get"),
+	Short: messages.GetShort("get"),
+	Long:  messages.GetLong("get"),
+	Args:  cobra.ExactArgs(1),
+	RunE:  handleGetCmd,
+}
+
+// handleGetCmd prints the effective value of a parameter
+func handleGetCmd(cmd *cobra.Command, args []string) error {
+	log.Debugf("%s: start", cmd.Use)
+	defer log.Debugf("%s: end", cmd.Use)
+
+	cfg := config.New()
+
+	d, err := data.New(*cfg)
+	if err != nil {
+		return err
+	}
+	if err := d.Open(); err != nil {
+		return err
+	}
+
+	value, err := d.GetEffective(args[0])
+	if err != nil {
+		return err
+	}
+
+	if OutputJSON {
+		jsonBytes, _ := json.MarshalIndent(value, "", "  ")
+		fmt.Println(string(jsonBytes))
+	} else {
+		fmt.Println(value.Value)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(GetCmd)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetCommand(t *testing.T) {
+	tmpDir := setupTestEnvironment(t)
+	initializeTestData(t)
+
+	catalog := `{"roles": {"database": {"options": {"DB_PORT": "5432"}}}}`
+	if err := os.WriteFile(filepath.Join(tmpDir, "catalog.json"), []byte(catalog), 0644); err != nil {
+		t.Fatalf("Failed to write catalog: %v", err)
+	}
+
+	if err := GetCmd.RunE(GetCmd, []string{"DB_PORT"}); err == nil {
+		t.Error("Expected error for an option without value")
+	}
+
+	if err := roleAddCmd.RunE(roleAddCmd, []string{"database"}); err != nil {
+		t.Fatalf("Failed to add role: %v", err)
+	}
+	if err := GetCmd.RunE(GetCmd, []string{"DB_PORT"}); err != nil {
+		t.Errorf("Expected role default to be found: %v", err)
+	}
+	if err := GetCmd.RunE(GetCmd, []string{"TIMEZONE"}); err != nil {
+		t.Errorf("Expected explicit option to be found: %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jvzantvoort/scmt/config"
+	"github.com/jvzantvoort/scmt/data"
+	"github.com/jvzantvoort/scmt/messages"
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// ImportCmd represents the import command
+var ImportCmd = &cobra.Command{
+	Use:   messages.GetUse("import"),
+	Short: messages.GetShort("import"),
+	Long:  messages.GetLong("import"),
+	Args:  cobra.ExactArgs(1),
+	RunE:  handleImportCmd,
+}
+
+// handleImportCmd sets the options read from a file
+func handleImportCmd(cmd *cobra.Command, args []string) error {
+	log.Debugf("%s: start", cmd.Use)
+	defer log.Debugf("%s: end", cmd.Use)
+
+	file := args[0]
+	replace := GetBool(*cmd, "replace")
+	if replace && GetBool(*cmd, "merge") {
+		return fmt.Errorf("--merge and --replace cannot be combined")
+	}
+
+	format := GetString(*cmd, "format")
+	if format == "" {
+		format = data.ImportFormat(file)
+	}
+
+	var content []byte
+	var err error
+	if file == "-" {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+
+	options, err := data.ParseImport(format, content)
+	if err != nil {
+		return fmt.Errorf("failed to import %s: %w", file, err)
+	}
+
+	cfg := config.New()
+
+	d, err := data.New(*cfg)
+	if err != nil {
+		return err
+	}
+	unlock, err := d.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := d.Open(); err != nil {
+		return err
+	}
+
+	var changes []data.ImportChange
+	dryRun := GetBool(*cmd, "dry-run")
+	if dryRun {
+		changes = d.ImportChanges(options, replace)
+	} else {
+		message := Message
+		if message == "" {
+			message = fmt.Sprintf("Import from %s", file)
+		}
+		changes, err = d.Import(options, replace, Engineer, message)
+		if err != nil {
+			return err
+		}
+		if len(changes) > 0 {
+			if err := d.Save(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if OutputJSON {
+		output := map[string]interface{}{
+			"action":  "import",
+			"file":    file,
+			"format":  format,
+			"dry_run": dryRun,
+			"changes": changes,
+		}
+		jsonBytes, _ := json.MarshalIndent(output, "", "  ")
+		fmt.Println(string(jsonBytes))
+		return nil
+	}
+
+	if len(changes) == 0 {
+		fmt.Println("No changes")
+		return nil
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.Header([]string{"Option", "Action", "Old", "New"})
+	tabledata := [][]string{}
+	for _, change := range changes {
+		tabledata = append(tabledata, []string{change.Option, change.Action, change.Old, change.New})
+	}
+	if err := table.Bulk(tabledata); err != nil {
+		return err
+	}
+	return table.Render()
+}
+
+func init() {
+	rootCmd.AddCommand(ImportCmd)
+
+	ImportCmd.Flags().String("format", "", "Format of the file: env, json, yaml or ini (default from the extension)")
+	ImportCmd.Flags().Bool("merge", false, "Keep options missing from the file (default)")
+	ImportCmd.Flags().Bool("replace", false, "Remove options missing from the file")
+	ImportCmd.Flags().BoolP("dry-run", "n", false, "List the changes without making them")
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jvzantvoort/scmt/config"
+	"github.com/jvzantvoort/scmt/data"
+)
+
+func TestImportCommand(t *testing.T) {
+	tmpDir := setupTestEnvironment(t)
+	initializeTestData(t)
+
+	// Without a message the file is named in the audit log
+	Message = ""
+	defer func() { Message = "test message" }()
+
+	file := filepath.Join(tmpDir, "facts.yaml")
+	if err := os.WriteFile(file, []byte("OWNER: DevOps\ndatabase:\n  port: 5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to write import file: %v", err)
+	}
+
+	openData := func() *data.Data {
+		d, err := data.New(*config.New())
+		if err != nil {
+			t.Fatalf("Failed to create data: %v", err)
+		}
+		if err := d.Open(); err != nil {
+			t.Fatalf("Failed to open data: %v", err)
+		}
+		return d
+	}
+
+	// A dry run changes nothing
+	_ = ImportCmd.Flags().Set("dry-run", "true")
+	err := ImportCmd.RunE(ImportCmd, []string{file})
+	_ = ImportCmd.Flags().Set("dry-run", "false")
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if _, err := openData().Get("database_port"); err == nil {
+		t.Error("Expected dry run not to import")
+	}
+
+	if err := ImportCmd.RunE(ImportCmd, []string{file}); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	d := openData()
+	value, err := d.Get("database_port")
+	if err != nil || value.Value != "5432" {
+		t.Errorf("Expected database_port 5432, got %+v", value)
+	}
+	if value.Message != "Import from "+file {
+		t.Errorf("Expected the default import message, got '%s'", value.Message)
+	}
+	if _, err := d.Get("TIMEZONE"); err != nil {
+		t.Error("Expected merge to keep TIMEZONE")
+	}
+
+	_ = ImportCmd.Flags().Set("replace", "true")
+	_ = ImportCmd.Flags().Set("merge", "true")
+	err = ImportCmd.RunE(ImportCmd, []string{file})
+	_ = ImportCmd.Flags().Set("merge", "false")
+	defer func() { _ = ImportCmd.Flags().Set("replace", "false") }()
+	if err == nil {
+		t.Error("Expected error combining --merge and --replace")
+	}
+
+	if err := ImportCmd.RunE(ImportCmd, []string{file}); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if _, err := openData().Get("TIMEZONE"); err == nil {
+		t.Error("Expected replace to remove TIMEZONE")
+	}
+}
@@ -23,6 +23,13 @@ func handleInitCmd(cmd *cobra.Command, args []string) {
 	cfg := config.New()
 
 	if scmto, err := data.New(*cfg); err == nil {
+		unlock, err := scmto.Lock()
+		if err != nil {
+			log.Errorf("Failed to lock: %v", err)
+			return
+		}
+		defer unlock()
+
 		if err := scmto.Init(Engineer); err != nil {
 			log.Errorf("Failed to initialize: %v", err)
 			return
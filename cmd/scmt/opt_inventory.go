@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jvzantvoort/scmt/config"
+	"github.com/jvzantvoort/scmt/inventory"
+	"github.com/jvzantvoort/scmt/messages"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// InventoryCmd represents the inventory command
+var InventoryCmd = &cobra.Command{
+	Use:   messages.GetUse("inventory"),
+	Short: messages.GetShort("inventory"),
+	Long:  messages.GetLong("inventory"),
+	Args:  cobra.NoArgs,
+	RunE:  handleInventoryCmd,
+}
+
+// handleInventoryCmd writes an Ansible inventory of collected data files
+func handleInventoryCmd(cmd *cobra.Command, args []string) error {
+	log.Debugf("%s: start", cmd.Use)
+	defer log.Debugf("%s: end", cmd.Use)
+
+	from := GetString(*cmd, "from")
+	if from == "" {
+		return fmt.Errorf("--from is required")
+	}
+	groupBy, _ := cmd.Flags().GetStringSlice("group-by")
+
+	cfg := config.New()
+
+	inv, err := inventory.Load(*cfg, from, groupBy)
+	if err != nil {
+		return err
+	}
+
+	if host := GetString(*cmd, "host"); host != "" {
+		return inv.Host(host, os.Stdout)
+	}
+
+	switch format := GetString(*cmd, "format"); format {
+	case "json":
+		return inv.List(os.Stdout)
+	case "yaml":
+		return inv.YAML(os.Stdout)
+	default:
+		return fmt.Errorf("unsupported inventory format %q, use json or yaml", format)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(InventoryCmd)
+
+	InventoryCmd.Flags().String("from", "", "Directory with the collected data files")
+	InventoryCmd.Flags().StringSlice("group-by", []string{}, "Also group hosts by the values of these parameters")
+	InventoryCmd.Flags().String("format", "json", "Output format: json or yaml")
+	InventoryCmd.Flags().Bool("list", false, "List the inventory, as Ansible calls dynamic inventory scripts (default)")
+	InventoryCmd.Flags().String("host", "", "Show the variables of a host")
+}
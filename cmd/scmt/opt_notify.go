@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/jvzantvoort/scmt/config"
+	"github.com/jvzantvoort/scmt/messages"
+	"github.com/jvzantvoort/scmt/notify"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var notifyCmd = &cobra.Command{
+	Use:   messages.GetUse("notify"),
+	Short: messages.GetShort("notify"),
+	Long:  messages.GetLong("notify"),
+}
+
+var notifyFlushCmd = &cobra.Command{
+	Use:   "flush",
+	Short: "Retry the spooled notifications",
+	Long: `Retry the notifications that could not be delivered, oldest first.
+Delivered notifications are removed from the spool directory, the others
+are kept for the next flush. The command fails when notifications remain.`,
+	Args: cobra.NoArgs,
+	RunE: handleNotifyFlushCmd,
+}
+
+// handleNotifyFlushCmd retries the spooled notifications
+func handleNotifyFlushCmd(cmd *cobra.Command, args []string) error {
+	log.Debugf("%s: start", cmd.Use)
+	defer log.Debugf("%s: end", cmd.Use)
+
+	cfg := config.New()
+	notifier, err := notify.New(cfg.Notifyfile, cfg.Spooldir)
+	if err != nil {
+		return err
+	}
+
+	delivered, remaining, err := notifier.Flush()
+	if err != nil {
+		return err
+	}
+
+	if OutputJSON {
+		output := map[string]interface{}{
+			"action":    "flush",
+			"delivered": delivered,
+			"remaining": remaining,
+		}
+		jsonBytes, _ := json.MarshalIndent(output, "", "  ")
+		fmt.Println(string(jsonBytes))
+	} else {
+		fmt.Printf("%d notifications delivered, %d remaining\n", delivered, remaining)
+	}
+
+	if remaining > 0 {
+		return fmt.Errorf("%d notifications could not be delivered", remaining)
+	}
+	return nil
+}
+
+func init() {
+	notifyCmd.AddCommand(notifyFlushCmd)
+	rootCmd.AddCommand(notifyCmd)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/jvzantvoort/scmt/config"
+	"github.com/jvzantvoort/scmt/notify"
+)
+
+func TestNotifyFlushCommand(t *testing.T) {
+	setupTestEnvironment(t)
+
+	status := http.StatusServiceUnavailable
+	received := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status == http.StatusOK {
+			received++
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	cfg := config.New()
+	content := `{"webhooks": [{"url": "` + server.URL + `"}], "retries": 0}`
+	if err := os.WriteFile(cfg.Notifyfile, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write notifier config: %v", err)
+	}
+
+	// A failing webhook leaves the notification in the spool
+	notifier, err := notify.New(cfg.Notifyfile, cfg.Spooldir)
+	if err != nil {
+		t.Fatalf("Failed to create notifier: %v", err)
+	}
+	if err := notifier.Send(notify.NewEvent("OWNER", "", "Ops", "testuser", "test")); err == nil {
+		t.Fatal("Expected error for a failing webhook")
+	}
+	if err := notifyFlushCmd.RunE(notifyFlushCmd, []string{}); err == nil {
+		t.Error("Expected flush to fail while the webhook fails")
+	}
+
+	status = http.StatusOK
+	if err := notifyFlushCmd.RunE(notifyFlushCmd, []string{}); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if received != 1 {
+		t.Errorf("Expected 1 delivered notification, got %d", received)
+	}
+	if files, _ := notifier.Spooled(); len(files) != 0 {
+		t.Errorf("Expected an empty spool, got %v", files)
+	}
+}
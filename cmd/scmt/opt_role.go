@@ -3,10 +3,15 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
 
 	"github.com/jvzantvoort/scmt/config"
 	"github.com/jvzantvoort/scmt/data"
 	"github.com/jvzantvoort/scmt/messages"
+	"github.com/olekukonko/tablewriter"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -17,14 +22,26 @@ var roleCmd = &cobra.Command{
 	Long:  messages.GetLong("role"),
 }
 
+// Changes reported by role add and role set
+const (
+	RoleAdded     string = "added"
+	RoleRequired  string = "required"
+	RoleRemoved   string = "removed"
+	RoleUnchanged string = "unchanged"
+)
+
+// RoleChange is the change made to one role
+type RoleChange struct {
+	Role   string `json:"role"`
+	Change string `json:"change"`
+}
+
 var roleAddCmd = &cobra.Command{
-	Use:   "add <role>",
-	Short: "Add a role to the server",
-	Long:  "Add a new role to the server's role list",
-	Args:  cobra.ExactArgs(1),
+	Use:   "add <role>...",
+	Short: "Add roles to the server",
+	Long:  "Add new roles to the server's role list and render the templates in <configdir>/roles/<role>/templates",
+	Args:  cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		role := args[0]
-
 		cfg := config.New()
 
 		d, err := data.New(*cfg)
@@ -32,58 +49,241 @@ var roleAddCmd = &cobra.Command{
 			return err
 		}
 
+		unlock, err := d.Lock()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
 		err = d.Open()
 		if err != nil {
 			return err
 		}
 
-		changed, err := d.AddRole(role, Engineer, Message)
+		pairs, _ := cmd.Flags().GetStringArray("param")
+		params, err := data.ParseParameters(pairs)
 		if err != nil {
 			return err
 		}
+		description := GetString(*cmd, "description")
+		if len(args) > 1 && (description != "" || len(params) > 0) {
+			return fmt.Errorf("--description and --param apply to a single role")
+		}
 
-		if !changed {
-			if OutputJSON {
-				output := map[string]interface{}{
-					"action":  "add",
-					"role":    role,
-					"changed": false,
-					"message": "Role already exists",
-				}
-				jsonBytes, _ := json.MarshalIndent(output, "", "  ")
-				fmt.Println(string(jsonBytes))
-			} else {
-				fmt.Printf("Role '%s' already exists\n", role)
+		entries := []data.Role{}
+		for _, role := range args {
+			entries = append(entries, data.Role{
+				Name:        role,
+				Description: description,
+				Parameters:  params,
+			})
+		}
+		added, err := d.AddRoleEntries(entries, Engineer, Message)
+		if err != nil {
+			return err
+		}
+
+		if len(added) > 0 {
+			err = d.Save()
+			if err != nil {
+				return err
+			}
+		}
+
+		// Render the templates shipped with the added roles
+		files, renderErr := applyRoles(cfg, d, added, Engineer, false)
+
+		if err := printRoleChanges("add", roleChanges(args, added, nil), files); err != nil {
+			return err
+		}
+		return renderErr
+	},
+}
+
+var roleSetCmd = &cobra.Command{
+	Use:   "set [role]...",
+	Short: "Set the roles of the server",
+	Long: `Set the server's role list to exactly the given roles, adding and removing
+roles as needed, and render the templates of the added roles. The roles are
+read from the arguments and from the file given with --from, one role per
+line, where empty lines and lines starting with # are ignored. Use --from -
+to read the roles from stdin. An empty list, which removes every role, is
+refused unless --allow-empty is given.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		roles := append([]string{}, args...)
+		from := GetString(*cmd, "from")
+		if from != "" {
+			listed, err := readRoleList(from)
+			if err != nil {
+				return err
+			}
+			roles = append(roles, listed...)
+		}
+
+		// Removing every role must be asked for explicitly
+		if len(roles) == 0 && !GetBool(*cmd, "allow-empty") {
+			if from == "" {
+				return fmt.Errorf("no roles given, list the roles or use --from")
 			}
-			return nil
+			return fmt.Errorf("%s lists no roles, use --allow-empty to remove every role", from)
 		}
 
-		err = d.Save()
+		cfg := config.New()
+
+		d, err := data.New(*cfg)
 		if err != nil {
 			return err
 		}
 
-		if OutputJSON {
-			output := map[string]interface{}{
-				"action":  "add",
-				"role":    role,
-				"changed": true,
-				"message": "Role added successfully",
+		unlock, err := d.Lock()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		err = d.Open()
+		if err != nil {
+			return err
+		}
+
+		added, removed, err := d.SetRoles(roles, Engineer, Message)
+		if err != nil {
+			return err
+		}
+
+		if len(added) > 0 || len(removed) > 0 {
+			err = d.Save()
+			if err != nil {
+				return err
 			}
-			jsonBytes, _ := json.MarshalIndent(output, "", "  ")
-			fmt.Println(string(jsonBytes))
-		} else {
-			fmt.Printf("Role '%s' added successfully\n", role)
 		}
 
-		return nil
+		// Optionally remove the files rendered from the removed roles
+		files := []RoleFile{}
+		if GetBool(*cmd, "purge") {
+			for _, role := range removed {
+				purged, err := purgeRole(cfg, d, role, Engineer, GetBool(*cmd, "force"))
+				if err != nil {
+					return err
+				}
+				files = append(files, purged...)
+			}
+		}
+
+		// Render the templates shipped with the added roles
+		written, renderErr := applyRoles(cfg, d, added, Engineer, false)
+		files = append(files, written...)
+
+		if err := printRoleChanges("set", roleChanges(roles, added, removed), files); err != nil {
+			return err
+		}
+		return renderErr
 	},
 }
 
+// readRoleList reads role names from a file, or stdin for "-", one per line
+func readRoleList(file string) ([]string, error) {
+	var content []byte
+	var err error
+	if file == "-" {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read roles from %s: %w", file, err)
+	}
+
+	retv := []string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		retv = append(retv, line)
+	}
+	return retv, nil
+}
+
+// roleChanges summarizes the changes to the requested roles and the roles
+// added or removed along with them
+func roleChanges(requested, added, removed []string) []RoleChange {
+	isAdded := map[string]bool{}
+	for _, role := range added {
+		isAdded[role] = true
+	}
+
+	retv := []RoleChange{}
+	seen := map[string]bool{}
+	for _, role := range requested {
+		if seen[role] {
+			continue
+		}
+		seen[role] = true
+		change := RoleUnchanged
+		if isAdded[role] {
+			change = RoleAdded
+		}
+		retv = append(retv, RoleChange{Role: role, Change: change})
+	}
+	for _, role := range added {
+		if !seen[role] {
+			retv = append(retv, RoleChange{Role: role, Change: RoleRequired})
+		}
+	}
+	for _, role := range removed {
+		retv = append(retv, RoleChange{Role: role, Change: RoleRemoved})
+	}
+	return retv
+}
+
+// printRoleChanges prints the summary of role add or role set
+func printRoleChanges(action string, changes []RoleChange, files []RoleFile) error {
+	changed := false
+	for _, change := range changes {
+		if change.Change != RoleUnchanged {
+			changed = true
+		}
+	}
+
+	if OutputJSON {
+		output := map[string]interface{}{
+			"action":  action,
+			"changed": changed,
+			"changes": changes,
+			"files":   files,
+		}
+		jsonBytes, _ := json.MarshalIndent(output, "", "  ")
+		fmt.Println(string(jsonBytes))
+		return nil
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.Header([]string{"Role", "Change"})
+	tabledata := [][]string{}
+	for _, change := range changes {
+		tabledata = append(tabledata, []string{change.Role, change.Change})
+	}
+	if err := table.Bulk(tabledata); err != nil {
+		return err
+	}
+	if err := table.Render(); err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.Error != "" {
+			fmt.Printf("  %s %s: %s\n", file.Status, file.Destination, file.Error)
+		} else {
+			fmt.Printf("  %s %s\n", file.Status, file.Destination)
+		}
+	}
+	return nil
+}
+
 var roleRemoveCmd = &cobra.Command{
 	Use:   "remove <role>",
 	Short: "Remove a role from the server",
-	Long:  "Remove a role from the server's role list",
+	Long:  "Remove a role from the server's role list, with --purge also the files rendered from its templates",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		role := args[0]
@@ -95,6 +295,12 @@ var roleRemoveCmd = &cobra.Command{
 			return err
 		}
 
+		unlock, err := d.Lock()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
 		err = d.Open()
 		if err != nil {
 			return err
@@ -102,18 +308,7 @@ var roleRemoveCmd = &cobra.Command{
 
 		changed, err := d.RemoveRole(role, Engineer, Message)
 		if err != nil {
-			if OutputJSON {
-				output := map[string]interface{}{
-					"action": "remove",
-					"role":   role,
-					"error":  err.Error(),
-				}
-				jsonBytes, _ := json.MarshalIndent(output, "", "  ")
-				fmt.Println(string(jsonBytes))
-			} else {
-				fmt.Printf("Error: %s\n", err.Error())
-			}
-			return nil
+			return err
 		}
 
 		if changed {
@@ -123,17 +318,34 @@ var roleRemoveCmd = &cobra.Command{
 			}
 		}
 
+		// Optionally remove the files rendered from the role templates
+		files := []RoleFile{}
+		if GetBool(*cmd, "purge") {
+			files, err = purgeRole(cfg, d, role, Engineer, GetBool(*cmd, "force"))
+			if err != nil {
+				return err
+			}
+		}
+
 		if OutputJSON {
 			output := map[string]interface{}{
 				"action":  "remove",
 				"role":    role,
 				"changed": changed,
 				"message": "Role removed successfully",
+				"files":   files,
 			}
 			jsonBytes, _ := json.MarshalIndent(output, "", "  ")
 			fmt.Println(string(jsonBytes))
 		} else {
 			fmt.Printf("Role '%s' removed successfully\n", role)
+			for _, file := range files {
+				if file.Error != "" {
+					fmt.Printf("  %s %s: %s\n", file.Status, file.Destination, file.Error)
+				} else {
+					fmt.Printf("  %s %s\n", file.Status, file.Destination)
+				}
+			}
 		}
 
 		return nil
@@ -161,9 +373,10 @@ var roleListCmd = &cobra.Command{
 
 		if OutputJSON {
 			output := map[string]interface{}{
-				"action": "list",
-				"roles":  roles,
-				"count":  len(roles),
+				"action":  "list",
+				"roles":   roles,
+				"details": d.Roles,
+				"count":   len(roles),
 			}
 			jsonBytes, _ := json.MarshalIndent(output, "", "  ")
 			fmt.Println(string(jsonBytes))
@@ -171,13 +384,95 @@ var roleListCmd = &cobra.Command{
 			if len(roles) == 0 {
 				fmt.Println("No roles assigned to this server")
 			} else {
-				fmt.Printf("Server roles (%d):\n", len(roles))
-				for _, role := range roles {
-					fmt.Printf("  - %s\n", role)
+				table := tablewriter.NewWriter(os.Stdout)
+				table.Header([]string{"Role", "Description", "Parameters", "Engineer", "Added", "Message"})
+				tabledata := [][]string{}
+				for _, role := range d.Roles {
+					added := ""
+					if !role.Added.IsZero() {
+						added = role.Added.Format("2006-01-02 15:04")
+					}
+					tabledata = append(tabledata, []string{role.Name, role.Description, role.ParameterString(), role.Engineer, added, role.Message})
 				}
+				if err := table.Bulk(tabledata); err != nil {
+					return err
+				}
+				return table.Render()
+			}
+		}
+
+		return nil
+	},
+}
+
+var roleParamCmd = &cobra.Command{
+	Use:   "param <role> <key=value>...",
+	Short: "Set parameters of a role",
+	Long:  "Set key/value parameters of an assigned role, e.g. the port of a web-server role",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		role := args[0]
+
+		params, err := data.ParseParameters(args[1:])
+		if err != nil {
+			return err
+		}
+
+		cfg := config.New()
+
+		d, err := data.New(*cfg)
+		if err != nil {
+			return err
+		}
+
+		unlock, err := d.Lock()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		err = d.Open()
+		if err != nil {
+			return err
+		}
+
+		keys := make([]string, 0, len(params))
+		for key := range params {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		changed := false
+		for _, key := range keys {
+			updated, err := d.SetRoleParameter(role, key, params[key], Engineer, Message)
+			if err != nil {
+				return err
+			}
+			changed = changed || updated
+		}
+
+		if changed {
+			err = d.Save()
+			if err != nil {
+				return err
 			}
 		}
 
+		if OutputJSON {
+			output := map[string]interface{}{
+				"action":     "param",
+				"role":       role,
+				"changed":    changed,
+				"parameters": params,
+			}
+			jsonBytes, _ := json.MarshalIndent(output, "", "  ")
+			fmt.Println(string(jsonBytes))
+		} else if changed {
+			fmt.Printf("Role '%s' parameters updated\n", role)
+		} else {
+			fmt.Printf("Role '%s' parameters unchanged\n", role)
+		}
+
 		return nil
 	},
 }
@@ -186,9 +481,22 @@ func init() {
 	log.Debugf("role command init, start")
 	defer log.Debugf("role command init, end")
 
+	roleAddCmd.Flags().StringP("description", "d", "", "Description of the role")
+	roleAddCmd.Flags().StringArrayP("param", "p", []string{}, "Role parameter (KEY=VALUE)")
+
+	roleSetCmd.Flags().String("from", "", "File with the roles, one per line, - for stdin")
+	roleSetCmd.Flags().Bool("purge", false, "Remove the files rendered from the templates of removed roles")
+	roleSetCmd.Flags().BoolP("force", "f", false, "Also remove rendered files modified outside scmt")
+	roleSetCmd.Flags().Bool("allow-empty", false, "Allow an empty role list, removing every role")
+
+	roleRemoveCmd.Flags().Bool("purge", false, "Remove the files rendered from the role templates")
+	roleRemoveCmd.Flags().BoolP("force", "f", false, "Also remove rendered files modified outside scmt")
+
 	roleCmd.AddCommand(roleAddCmd)
 	roleCmd.AddCommand(roleRemoveCmd)
 	roleCmd.AddCommand(roleListCmd)
+	roleCmd.AddCommand(roleParamCmd)
+	roleCmd.AddCommand(roleSetCmd)
 
 	rootCmd.AddCommand(roleCmd)
 }
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/jvzantvoort/scmt/config"
 	"github.com/jvzantvoort/scmt/data"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -189,10 +193,10 @@ func TestRoleRemoveCommand_NonExistent_Integration(t *testing.T) {
 	setupTestEnvironment(t)
 	initializeTestData(t)
 
-	// Try removing non-existent role - should not error (prints message instead)
+	// Removing a non-existent role fails the command
 	err := roleRemoveCmd.RunE(roleRemoveCmd, []string{"nonexistent"})
-	if err != nil {
-		t.Fatalf("Command should handle non-existent role gracefully: %v", err)
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("Expected removing a non-existent role to fail, got %v", err)
 	}
 }
 
@@ -220,3 +224,205 @@ func TestRoleCommands_JSONOutput_Integration(t *testing.T) {
 		t.Fatalf("Failed to remove role with JSON output: %v", err)
 	}
 }
+
+func TestRoleAddCommand_Metadata_Integration(t *testing.T) {
+	setupTestEnvironment(t)
+	initializeTestData(t)
+
+	flags := roleAddCmd.Flags()
+	_ = flags.Set("description", "Public web frontend")
+	_ = flags.Set("param", "port=8080")
+	defer func() {
+		_ = flags.Set("description", "")
+		_ = flags.Lookup("param").Value.(pflag.SliceValue).Replace([]string{})
+	}()
+
+	if err := roleAddCmd.RunE(roleAddCmd, []string{"web-server"}); err != nil {
+		t.Fatalf("Failed to add role: %v", err)
+	}
+
+	if err := roleParamCmd.RunE(roleParamCmd, []string{"web-server", "workers=4", "port=8443"}); err != nil {
+		t.Fatalf("Failed to set role parameters: %v", err)
+	}
+	if err := roleParamCmd.RunE(roleParamCmd, []string{"web-server", "broken"}); err == nil {
+		t.Error("Expected error for invalid parameter")
+	}
+	if err := roleParamCmd.RunE(roleParamCmd, []string{"nonexistent", "a=b"}); err == nil {
+		t.Error("Expected error for unassigned role")
+	}
+
+	cfg := config.New()
+	d, err := data.New(*cfg)
+	if err != nil {
+		t.Fatalf("Failed to create data: %v", err)
+	}
+	if err := d.Open(); err != nil {
+		t.Fatalf("Failed to open data: %v", err)
+	}
+
+	role, err := d.GetRole("web-server")
+	if err != nil {
+		t.Fatalf("Failed to get role: %v", err)
+	}
+	if role.Description != "Public web frontend" {
+		t.Errorf("Expected description 'Public web frontend', got '%s'", role.Description)
+	}
+	if role.Engineer != "testuser" || role.Message != "test message" {
+		t.Errorf("Expected engineer and message to be recorded, got %+v", role)
+	}
+	if role.ParameterString() != "port=8443,workers=4" {
+		t.Errorf("Expected 'port=8443,workers=4', got '%s'", role.ParameterString())
+	}
+
+	// Role parameters are available to templates
+	td, err := prepareTemplateData(d, Engineer, false)
+	if err != nil {
+		t.Fatalf("Failed to prepare template data: %v", err)
+	}
+	if td.RoleParam("web-server", "port") != "8443" {
+		t.Errorf("Expected RoleParam port '8443', got '%s'", td.RoleParam("web-server", "port"))
+	}
+	if td.RoleParam("database", "port") != "" {
+		t.Error("Expected empty RoleParam for unassigned role")
+	}
+	if td.RoleDetails["web-server"].Description != "Public web frontend" {
+		t.Errorf("Expected role details in template data, got %+v", td.RoleDetails)
+	}
+
+	if err := roleListCmd.RunE(roleListCmd, []string{}); err != nil {
+		t.Fatalf("Failed to list roles: %v", err)
+	}
+}
+
+func TestRoleCommands_Catalog(t *testing.T) {
+	tmpDir := setupTestEnvironment(t)
+	initializeTestData(t)
+
+	catalog := `{"roles": {"web-server": {"requires": ["tls-client"]}, "tls-client": {}}}`
+	if err := os.WriteFile(filepath.Join(tmpDir, "catalog.json"), []byte(catalog), 0644); err != nil {
+		t.Fatalf("Failed to write catalog: %v", err)
+	}
+
+	if err := roleAddCmd.RunE(roleAddCmd, []string{"web-server"}); err != nil {
+		t.Fatalf("Failed to add role: %v", err)
+	}
+
+	cfg := config.New()
+	d, err := data.New(*cfg)
+	if err != nil {
+		t.Fatalf("Failed to create data: %v", err)
+	}
+	if err := d.Open(); err != nil {
+		t.Fatalf("Failed to open data: %v", err)
+	}
+	if !d.HasRole("tls-client") {
+		t.Error("Expected required role 'tls-client' to be added")
+	}
+
+	// Removing a required role is refused, fails the command and leaves the
+	// data alone
+	err = roleRemoveCmd.RunE(roleRemoveCmd, []string{"tls-client"})
+	if err == nil || !strings.Contains(err.Error(), "required by web-server") {
+		t.Errorf("Expected removing a required role to fail, got %v", err)
+	}
+	if err := d.Open(); err != nil {
+		t.Fatalf("Failed to open data: %v", err)
+	}
+	if !d.HasRole("tls-client") {
+		t.Error("Expected required role 'tls-client' to be kept")
+	}
+}
+
+func TestRoleCommands_Bulk(t *testing.T) {
+	tmpDir := setupTestEnvironment(t)
+	initializeTestData(t)
+
+	if err := roleAddCmd.RunE(roleAddCmd, []string{"web-server", "database", "cache"}); err != nil {
+		t.Fatalf("Failed to add roles: %v", err)
+	}
+
+	// Description and parameters apply to a single role
+	flags := roleAddCmd.Flags()
+	_ = flags.Set("description", "Shared")
+	err := roleAddCmd.RunE(roleAddCmd, []string{"a", "b"})
+	_ = flags.Set("description", "")
+	if err == nil {
+		t.Error("Expected error for --description with several roles")
+	}
+
+	rolesFile := filepath.Join(tmpDir, "roles.txt")
+	content := "# roles of this server\nweb-server\n\nmonitoring\n"
+	if err := os.WriteFile(rolesFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write roles file: %v", err)
+	}
+
+	_ = roleSetCmd.Flags().Set("from", rolesFile)
+	defer func() { _ = roleSetCmd.Flags().Set("from", "") }()
+
+	OutputJSON = true
+	defer func() { OutputJSON = false }()
+	if err := roleSetCmd.RunE(roleSetCmd, []string{"backup-client"}); err != nil {
+		t.Fatalf("Failed to set roles: %v", err)
+	}
+
+	cfg := config.New()
+	d, err := data.New(*cfg)
+	if err != nil {
+		t.Fatalf("Failed to create data: %v", err)
+	}
+	if err := d.Open(); err != nil {
+		t.Fatalf("Failed to open data: %v", err)
+	}
+	roles := d.ListRoles()
+	sort.Strings(roles)
+	if strings.Join(roles, ",") != "backup-client,monitoring,web-server" {
+		t.Errorf("Expected backup-client,monitoring,web-server, got %v", roles)
+	}
+
+	// An empty list does not remove every role unless asked for
+	if err := os.WriteFile(rolesFile, []byte("# nothing yet\n"), 0644); err != nil {
+		t.Fatalf("Failed to write roles file: %v", err)
+	}
+	if err := roleSetCmd.RunE(roleSetCmd, []string{}); err == nil {
+		t.Error("Expected error for an empty roles file")
+	}
+	_ = roleSetCmd.Flags().Set("from", "")
+	if err := roleSetCmd.RunE(roleSetCmd, []string{}); err == nil {
+		t.Error("Expected error without roles and --from")
+	}
+	if err := d.Open(); err != nil {
+		t.Fatalf("Failed to open data: %v", err)
+	}
+	if len(d.Roles) != 3 {
+		t.Errorf("Expected the roles to be kept, got %v", d.ListRoles())
+	}
+
+	_ = roleSetCmd.Flags().Set("allow-empty", "true")
+	defer func() { _ = roleSetCmd.Flags().Set("allow-empty", "false") }()
+	if err := roleSetCmd.RunE(roleSetCmd, []string{}); err != nil {
+		t.Fatalf("Failed to remove every role with --allow-empty: %v", err)
+	}
+	d, _ = data.New(*cfg)
+	if err := d.Open(); err != nil {
+		t.Fatalf("Failed to open data: %v", err)
+	}
+	if len(d.Roles) != 0 {
+		t.Errorf("Expected no roles with --allow-empty, got %v", d.ListRoles())
+	}
+
+	changes := roleChanges([]string{"web-server", "web-server", "tls"}, []string{"tls", "ca"}, []string{"db"})
+	expected := []RoleChange{
+		{Role: "web-server", Change: RoleUnchanged},
+		{Role: "tls", Change: RoleAdded},
+		{Role: "ca", Change: RoleRequired},
+		{Role: "db", Change: RoleRemoved},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], changes[i])
+		}
+	}
+}
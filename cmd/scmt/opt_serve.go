@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jvzantvoort/scmt/config"
+	"github.com/jvzantvoort/scmt/messages"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// DefaultListen is the address scmt serve listens on by default
+const DefaultListen string = "unix:/run/scmt.sock"
+
+// ServeCmd represents the serve command
+var ServeCmd = &cobra.Command{
+	Use:          messages.GetUse("serve"),
+	Short:        messages.GetShort("serve"),
+	Long:         messages.GetLong("serve"),
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         handleServeCmd,
+}
+
+// handleServeCmd serves the API until interrupted
+func handleServeCmd(cmd *cobra.Command, args []string) error {
+	log.Debugf("%s: start", cmd.Use)
+	defer log.Debugf("%s: end", cmd.Use)
+
+	address := GetString(*cmd, "listen")
+	listener, err := apiListen(address)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Handler:           (&APIServer{Config: config.New()}).Handler(),
+		ConnContext:       apiConnContext,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+	log.Infof("Listening on %s", address)
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Infof("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// apiListen listens on unix:<path> or on a loopback host:port. The API is
+// meant for tools on the same host, other TCP addresses are refused.
+func apiListen(address string) (net.Listener, error) {
+	if path, found := strings.CutPrefix(address, "unix:"); found {
+		return unixListen(path)
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listen address %s, use unix:<path> or 127.0.0.1:<port>: %w", address, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("listen address %s is not a loopback address", address)
+	}
+	return net.Listen("tcp", address)
+}
+
+// unixListen listens on a unix socket, replacing a socket left behind by a
+// server that is no longer running. Only the owner and group can connect.
+func unixListen(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another server", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0660); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set permissions of %s: %w", path, err)
+	}
+	return listener, nil
+}
+
+func init() {
+	ServeCmd.Flags().String("listen", DefaultListen, "Address to listen on, unix:<path> or 127.0.0.1:<port>")
+
+	rootCmd.AddCommand(ServeCmd)
+}
@@ -37,12 +37,19 @@ func handleSetCmd(cmd *cobra.Command, args []string) {
 	cfg := config.New()
 
 	if scmto, err := data.New(*cfg); err == nil {
+		unlock, err := scmto.Lock()
+		if err != nil {
+			cobra.CheckErr(err)
+			return
+		}
+		defer unlock()
+
 		if err := scmto.Open(); err != nil {
 			cobra.CheckErr(err)
 			return
 		}
 
-		err := scmto.SafeSet(option_name, option_value, viper.GetString("engineer"), viper.GetString("message"))
+		err = scmto.SafeSet(option_name, option_value, viper.GetString("engineer"), viper.GetString("message"))
 
 		cobra.CheckErr(err)
 	}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jvzantvoort/scmt/config"
+	"github.com/jvzantvoort/scmt/data"
+	"github.com/jvzantvoort/scmt/messages"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var templateCmd = &cobra.Command{
+	Use:   messages.GetUse("template"),
+	Short: messages.GetShort("template"),
+	Long:  messages.GetLong("template"),
+}
+
+var templateLintCmd = &cobra.Command{
+	Use:   messages.GetUse("template-lint"),
+	Short: messages.GetShort("template-lint"),
+	Long:  messages.GetLong("template-lint"),
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  handleTemplateLintCmd,
+}
+
+// handleTemplateLintCmd lints the templates given as arguments
+func handleTemplateLintCmd(cmd *cobra.Command, args []string) error {
+	// JSON output is read from stdout, keep it clean
+	if OutputJSON {
+		log.SetOutput(os.Stderr)
+	}
+
+	log.Debugf("%s: start", cmd.Use)
+	defer log.Debugf("%s: end", cmd.Use)
+
+	cfg := config.New()
+	opts := newTemplateOptions(cfg)
+
+	// Without data.json only the references are listed
+	var known map[string]string
+	d, err := data.New(*cfg)
+	if err != nil {
+		return err
+	}
+	if err := d.Open(); err != nil {
+		log.Warnf("Not checking configuration keys: %v", err)
+	} else if known, err = d.EffectiveMap(); err != nil {
+		return err
+	}
+
+	results := []LintResult{}
+	failed := 0
+	warnings := 0
+	for _, arg := range args {
+		result := lintTemplate(resolveTemplate(arg, opts.SearchPath), known, opts)
+		if result.Error != "" {
+			failed++
+		}
+		warnings += len(result.Warnings)
+		results = append(results, result)
+	}
+
+	if OutputJSON {
+		jsonBytes, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Println(string(jsonBytes))
+	} else {
+		for _, result := range results {
+			fmt.Printf("%s:\n", result.File)
+			if result.Error != "" {
+				fmt.Printf("  error:   %s\n", result.Error)
+				continue
+			}
+			fmt.Printf("  keys:    %s\n", strings.Join(result.Keys, ", "))
+			fmt.Printf("  roles:   %s\n", strings.Join(result.Roles, ", "))
+			for _, warning := range result.Warnings {
+				fmt.Printf("  warning: %s\n", warning)
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d templates failed to parse", failed, len(results))
+	}
+	if warnings > 0 && GetBool(*cmd, "fail-on-warning") {
+		return fmt.Errorf("%d warnings reported", warnings)
+	}
+	return nil
+}
+
+func init() {
+	templateLintCmd.Flags().Bool("fail-on-warning", false, "Fail when any warning is reported")
+
+	templateCmd.AddCommand(templateLintCmd)
+	rootCmd.AddCommand(templateCmd)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jvzantvoort/scmt/config"
+	"github.com/jvzantvoort/scmt/data"
+	"github.com/jvzantvoort/scmt/messages"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// TFExternalQuery is the query Terraform passes on stdin. The external data
+// source only passes strings, so keys is a comma separated list.
+type TFExternalQuery struct {
+	Keys     string `json:"keys"`
+	DataFile string `json:"data_file"`
+}
+
+// TFExternalCmd represents the tf-external command
+var TFExternalCmd = &cobra.Command{
+	Use:          messages.GetUse("tf-external"),
+	Short:        messages.GetShort("tf-external"),
+	Long:         messages.GetLong("tf-external"),
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         handleTFExternalCmd,
+}
+
+// handleTFExternalCmd answers a Terraform external data source query
+func handleTFExternalCmd(cmd *cobra.Command, args []string) error {
+	// Terraform reads the result from stdout, keep it clean
+	log.SetOutput(os.Stderr)
+
+	log.Debugf("%s: start", cmd.Use)
+	defer log.Debugf("%s: end", cmd.Use)
+
+	query, err := readTFExternalQuery(os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	cfg := config.New()
+	if query.DataFile != "" {
+		cfg.ConfigDatafile = query.DataFile
+	}
+
+	d, err := data.New(*cfg)
+	if err != nil {
+		return err
+	}
+	if err := d.Open(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", cfg.ConfigDatafile, err)
+	}
+
+	result, err := tfExternalResult(d, query)
+	if err != nil {
+		return err
+	}
+
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(jsonBytes))
+	return nil
+}
+
+// readTFExternalQuery parses the query, an empty input is an empty query
+func readTFExternalQuery(reader io.Reader) (*TFExternalQuery, error) {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read query: %w", err)
+	}
+
+	query := &TFExternalQuery{}
+	if strings.TrimSpace(string(content)) == "" {
+		return query, nil
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(content)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(query); err != nil {
+		return nil, fmt.Errorf("failed to parse query: %w", err)
+	}
+	return query, nil
+}
+
+// tfExternalResult returns the selected keys of the effective configuration
+// and the roles in SCMT_ROLES, all keys when none are selected
+func tfExternalResult(d *data.Data, query *TFExternalQuery) (map[string]string, error) {
+	all, err := d.EffectiveMap()
+	if err != nil {
+		return nil, err
+	}
+	if _, found := all[data.RolesVariable]; found {
+		return nil, fmt.Errorf("option %s collides with the key holding the roles", data.RolesVariable)
+	}
+	all[data.RolesVariable] = strings.Join(d.ListRoles(), ",")
+
+	if strings.TrimSpace(query.Keys) == "" {
+		return all, nil
+	}
+
+	retv := map[string]string{}
+	for _, key := range strings.Split(query.Keys, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		value, found := all[key]
+		if !found {
+			return nil, fmt.Errorf("option %s not found", key)
+		}
+		retv[key] = value
+	}
+	return retv, nil
+}
+
+func init() {
+	rootCmd.AddCommand(TFExternalCmd)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jvzantvoort/scmt/config"
+	"github.com/jvzantvoort/scmt/data"
+)
+
+func TestReadTFExternalQuery(t *testing.T) {
+	query, err := readTFExternalQuery(strings.NewReader(`{"keys": "OWNER,TYPE", "data_file": "/srv/scmt/web01.json"}`))
+	if err != nil {
+		t.Fatalf("Failed to read query: %v", err)
+	}
+	if query.Keys != "OWNER,TYPE" || query.DataFile != "/srv/scmt/web01.json" {
+		t.Errorf("Unexpected query %+v", query)
+	}
+
+	query, err = readTFExternalQuery(strings.NewReader(""))
+	if err != nil || query.Keys != "" {
+		t.Errorf("Expected an empty query, got %+v, %v", query, err)
+	}
+
+	if _, err := readTFExternalQuery(strings.NewReader(`{"key": "OWNER"}`)); err == nil {
+		t.Error("Expected error for an unknown field")
+	}
+	if _, err := readTFExternalQuery(strings.NewReader(`{"keys": ["OWNER"]}`)); err == nil {
+		t.Error("Expected error for a non-string field")
+	}
+}
+
+func TestTFExternalResult(t *testing.T) {
+	setupTestEnvironment(t)
+	initializeTestData(t)
+
+	d, err := data.New(*config.New())
+	if err != nil {
+		t.Fatalf("Failed to create data: %v", err)
+	}
+	if err := d.Open(); err != nil {
+		t.Fatalf("Failed to open data: %v", err)
+	}
+	if _, err := d.AddRole("web-server", "testuser", "test"); err != nil {
+		t.Fatalf("Failed to add role: %v", err)
+	}
+
+	result, err := tfExternalResult(d, &TFExternalQuery{Keys: "OWNER, SCMT_ROLES"})
+	if err != nil {
+		t.Fatalf("Failed to build result: %v", err)
+	}
+	if len(result) != 2 || result["OWNER"] != "Mad House" || result["SCMT_ROLES"] != "web-server" {
+		t.Errorf("Unexpected result %v", result)
+	}
+
+	result, err = tfExternalResult(d, &TFExternalQuery{})
+	if err != nil {
+		t.Fatalf("Failed to build result: %v", err)
+	}
+	if result["TIMEZONE"] != "Europe/Amsterdam" || result["SCMT_ROLES"] != "web-server" {
+		t.Errorf("Expected all keys, got %v", result)
+	}
+
+	if _, err := tfExternalResult(d, &TFExternalQuery{Keys: "NONEXISTENT"}); err == nil {
+		t.Error("Expected error for an unknown key")
+	}
+
+	// An option named like the roles key is refused, not overwritten
+	if _, err := d.Set(data.RolesVariable, "database", "testuser", "test"); err != nil {
+		t.Fatalf("Failed to set option: %v", err)
+	}
+	if _, err := tfExternalResult(d, &TFExternalQuery{}); err == nil || !strings.Contains(err.Error(), data.RolesVariable) {
+		t.Errorf("Expected error for option %s, got %v", data.RolesVariable, err)
+	}
+}
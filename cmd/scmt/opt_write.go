@@ -1,27 +1,55 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
-	"text/template"
 	"time"
 
 	"github.com/jvzantvoort/scmt/config"
 	"github.com/jvzantvoort/scmt/data"
+	"github.com/jvzantvoort/scmt/facts"
 	"github.com/jvzantvoort/scmt/messages"
+	"github.com/jvzantvoort/scmt/state"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
+// timestampLayout is the layout of .Timestamp and .LastChanged
+const timestampLayout = "2006-01-02 15:04:05"
+
+// timeNow returns the render time outside reproducible mode, it is a
+// variable so tests can move the clock
+var timeNow = time.Now
+
 // TemplateData represents the data structure available to templates
 type TemplateData struct {
-	Config    map[string]string `json:"config"`
-	Roles     []string          `json:"roles"`
-	Timestamp string            `json:"timestamp"`
-	Engineer  string            `json:"engineer"`
+	Config       map[string]string    `json:"config"`
+	Roles        []string             `json:"roles"`
+	RoleDetails  map[string]data.Role `json:"role_details"`
+	Timestamp    string               `json:"timestamp"`
+	Engineer     string               `json:"engineer"`
+	LastChanged  string               `json:"last_changed"`
+	LastEngineer string               `json:"last_engineer"`
+
+	renderTime time.Time    // time returned by now, zero for the current time
+	facts      *facts.Facts // facts returned by Facts, nil until first used
+}
+
+// Facts returns the facts of the local host. They are gathered on first use,
+// so templates that do not use .Facts skip the lookups.
+func (td *TemplateData) Facts() facts.Facts {
+	if td.facts == nil {
+		gathered := facts.Gather()
+		td.facts = &gathered
+	}
+	return *td.facts
 }
 
 // HasRole checks if a specific role exists
@@ -34,6 +62,54 @@ func (td TemplateData) HasRole(role string) bool {
 	return false
 }
 
+// RoleParam returns a parameter of an assigned role, empty when either the
+// role or the parameter does not exist
+func (td TemplateData) RoleParam(role, key string) string {
+	return td.RoleDetails[role].Parameters[key]
+}
+
+// Required returns the value of a configuration key and fails when the key
+// is missing or empty
+func (td TemplateData) Required(key string) (string, error) {
+	value, ok := td.Config[key]
+	if !ok || value == "" {
+		return "", fmt.Errorf("required configuration key %q is not set", key)
+	}
+	return value, nil
+}
+
+// Now returns the render time formatted with the optional Go time layout,
+// defaulting to the layout of .Timestamp
+func (td TemplateData) Now(layout ...string) string {
+	format := timestampLayout
+	if len(layout) > 0 {
+		format = layout[0]
+	}
+	if td.renderTime.IsZero() {
+		return timeNow().Format(format)
+	}
+	return td.renderTime.Format(format)
+}
+
+// Override sets configuration values from KEY=VALUE pairs and adds roles,
+// without touching the data they were prepared from
+func (td *TemplateData) Override(overrides, roles []string) error {
+	for _, override := range overrides {
+		key, value, found := strings.Cut(override, "=")
+		if !found || key == "" {
+			return fmt.Errorf("invalid override %q, expected KEY=VALUE", override)
+		}
+		td.Config[key] = value
+	}
+	for _, role := range roles {
+		if !td.HasRole(role) {
+			td.Roles = append(td.Roles, role)
+		}
+	}
+	sort.Strings(td.Roles)
+	return nil
+}
+
 // WriteCmd represents the write command
 var WriteCmd = &cobra.Command{
 	Use:   messages.GetUse("write"),
@@ -48,7 +124,6 @@ func handleWriteCmd(cmd *cobra.Command, args []string) error {
 	log.Debugf("%s: start", cmd.Use)
 	defer log.Debugf("%s: end", cmd.Use)
 
-	templateFile := args[0]
 	var outputFile string
 
 	// Determine output destination
@@ -58,6 +133,20 @@ func handleWriteCmd(cmd *cobra.Command, args []string) error {
 
 	// Load configuration
 	cfg := config.New()
+	opts := newTemplateOptions(cfg)
+	templateFile := resolveTemplate(args[0], opts.SearchPath)
+
+	// Rendering from another data file or with overrides is a preview: the
+	// local state is neither checked, recorded nor audited
+	dataFile := GetString(*cmd, "data")
+	overrides, _ := cmd.Flags().GetStringArray("set")
+	extraRoles, _ := cmd.Flags().GetStringSlice("role")
+	preview := dataFile != "" || len(overrides) > 0 || len(extraRoles) > 0
+
+	if dataFile != "" {
+		cfg.ConfigDatafile = dataFile
+	}
+
 	d, err := data.New(*cfg)
 	if err != nil {
 		return fmt.Errorf("failed to create data: %w", err)
@@ -67,75 +156,209 @@ func handleWriteCmd(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("failed to load configuration: %w", err)
 	}
+	// Rendering does not change the data, so the lock is not held
+	defer d.SendNotifications()
 
 	// Prepare template data
-	templateData, err := prepareTemplateData(d)
+	templateData, err := prepareTemplateData(d, Engineer, cfg.Reproducible)
 	if err != nil {
 		return fmt.Errorf("failed to prepare template data: %w", err)
 	}
 
-	// Process template
-	err = processTemplate(templateFile, outputFile, templateData)
+	// Facts of this host do not describe the host of another data file
+	if dataFile != "" {
+		templateData.facts = &facts.Facts{}
+	}
+
+	if err := templateData.Override(overrides, extraRoles); err != nil {
+		return err
+	}
+
+	// Renders to stdout are not tracked
+	if outputFile == "" {
+		err = processTemplate(templateFile, outputFile, templateData, opts)
+		if err != nil {
+			return fmt.Errorf("failed to process template: %w", err)
+		}
+		return nil
+	}
+
+	st, err := state.New(cfg.Statefile)
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+	if preview {
+		return renderPreview(st, templateFile, outputFile, templateData, opts, GetBool(*cmd, "force"))
+	}
+	return renderFile(d, st, templateFile, outputFile, templateData, opts, Engineer, GetBool(*cmd, "force"))
+}
+
+// renderPreview renders templateFile into outputFile without tracking it. A
+// preview does not describe this server, so it may only replace a file scmt
+// rendered when force is set.
+func renderPreview(st *state.State, templateFile, outputFile string, templateData *TemplateData, opts TemplateOptions, force bool) error {
+	status, err := st.Check(outputFile)
 	if err != nil {
+		return fmt.Errorf("failed to check %s for drift: %w", outputFile, err)
+	}
+	if status != state.StatusUntracked {
+		if !force {
+			return fmt.Errorf("output file %s is tracked by scmt, use --force to overwrite it with a preview", outputFile)
+		}
+		log.Warnf("Overwriting %s which is tracked by scmt with a preview", outputFile)
+	}
+
+	if err := processTemplate(templateFile, outputFile, templateData, opts); err != nil {
 		return fmt.Errorf("failed to process template: %w", err)
 	}
+	return nil
+}
 
-	// Log the operation if output file is specified
-	if outputFile != "" {
-		if err := d.Log("TEMPLATE_WRITE", fmt.Sprintf("%s -> %s", templateFile, outputFile), Engineer, fmt.Sprintf("Template processing: %s", templateFile)); err != nil {
-			log.Warnf("Failed to log template write: %v", err)
+// renderFile renders templateFile into outputFile on behalf of engineer,
+// refusing to clobber a file that was edited by hand unless force is set,
+// and records the checksum of the result in the state and the audit log
+func renderFile(d *data.Data, st *state.State, templateFile, outputFile string, templateData *TemplateData, opts TemplateOptions, engineer string, force bool) error {
+	status, err := st.Check(outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to check %s for drift: %w", outputFile, err)
+	}
+	if status == state.StatusModified {
+		if !force {
+			return fmt.Errorf("output file %s was modified outside scmt, use --force to overwrite", outputFile)
 		}
+		log.Warnf("Overwriting %s which was modified outside scmt", outputFile)
+	}
+
+	// The pre- hooks may veto the write
+	change := fmt.Sprintf("%s -> %s", templateFile, outputFile)
+	message := fmt.Sprintf("Template processing: %s", templateFile)
+	if err := d.PreChange("TEMPLATE_WRITE", "", change, engineer, message); err != nil {
+		return err
 	}
 
+	// Process template
+	err = processTemplate(templateFile, outputFile, templateData, opts)
+	if err != nil {
+		return fmt.Errorf("failed to process template: %w", err)
+	}
+
+	// Record the checksum and log the operation
+	checksum, err := state.FileChecksum(outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to checksum %s: %w", outputFile, err)
+	}
+	st.Record(outputFile, templateFile, checksum, engineer)
+	if err := st.Save(); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+
+	if err := d.LogChange("TEMPLATE_WRITE", "", change, engineer, message); err != nil {
+		log.Warnf("Failed to log template write: %v", err)
+	}
+
+	// The file is written, the write is committed
+	d.RunPostHooks()
 	return nil
 }
 
 // prepareTemplateData converts server data into template-friendly structure
-func prepareTemplateData(d *data.Data) (*TemplateData, error) {
-	// Extract configuration as key-value map
-	configMap := make(map[string]string)
+// rendered by engineer. In reproducible mode the timestamp and engineer are
+// derived from the data instead of the clock and the current user, so
+// unchanged data always renders the same output.
+func prepareTemplateData(d *data.Data, engineer string, reproducible bool) (*TemplateData, error) {
+	// The effective configuration includes the defaults of the roles
+	configMap, err := d.EffectiveMap()
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the latest explicit change of an element or role
+	var lastChanged time.Time
+	lastEngineer := ""
 	for _, element := range d.Elements {
-		configMap[element.Option] = element.Value.Value
+		if element.Value.Changed.After(lastChanged) {
+			lastChanged = element.Value.Changed
+			lastEngineer = element.Value.Engineer
+		}
+	}
+	for _, role := range d.Roles {
+		if role.Added.After(lastChanged) {
+			lastChanged = role.Added
+			lastEngineer = role.Engineer
+		}
 	}
 
-	// Get current timestamp
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
+	roles := d.ListRoles()
+	sort.Strings(roles)
+
+	roleDetails := make(map[string]data.Role)
+	for _, role := range d.Roles {
+		roleDetails[role.Name] = role
+	}
 
 	templateData := &TemplateData{
-		Config:    configMap,
-		Roles:     d.ListRoles(),
-		Timestamp: timestamp,
-		Engineer:  Engineer,
+		Config:       configMap,
+		Roles:        roles,
+		RoleDetails:  roleDetails,
+		Engineer:     engineer,
+		LastEngineer: lastEngineer,
+		renderTime:   timeNow(),
+	}
+	if !lastChanged.IsZero() {
+		templateData.LastChanged = lastChanged.UTC().Format(timestampLayout)
+	}
+
+	if reproducible {
+		renderTime, err := reproducibleTime(lastChanged)
+		if err != nil {
+			return nil, err
+		}
+		templateData.renderTime = renderTime
+		templateData.Engineer = lastEngineer
 	}
+	templateData.Timestamp = templateData.Now()
 
 	return templateData, nil
 }
 
-// processTemplate reads template file, processes it with data, and writes output
-func processTemplate(templateFile, outputFile string, data *TemplateData) error {
-	// Define template functions
-	funcMap := template.FuncMap{
-		"join":      strings.Join,
-		"upper":     strings.ToUpper,
-		"lower":     strings.ToLower,
-		"hasPrefix": strings.HasPrefix,
-		"hasSuffix": strings.HasSuffix,
-		"replace":   strings.Replace,
-		"split":     strings.Split,
-		"trim":      strings.TrimSpace,
-	}
-
-	// Read template file
-	templateContent, err := os.ReadFile(templateFile)
+// reproducibleTime returns the time of SOURCE_DATE_EPOCH when set, or else
+// the latest change in the data, in UTC. Data without changes renders with
+// the Unix epoch, never with the current time.
+func reproducibleTime(lastChanged time.Time) (time.Time, error) {
+	if epoch, found := os.LookupEnv("SOURCE_DATE_EPOCH"); found {
+		seconds, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %w", epoch, err)
+		}
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	if lastChanged.IsZero() {
+		return time.Unix(0, 0).UTC(), nil
+	}
+	return lastChanged.UTC(), nil
+}
+
+// renderTemplate reads template file and processes it with data into a
+// buffer, so a failing template never leaves a partially written output
+// behind
+func renderTemplate(templateFile string, data *TemplateData, opts TemplateOptions) (*bytes.Buffer, error) {
+	tmpl, err := loadTemplate(templateFile, data, opts)
 	if err != nil {
-		return fmt.Errorf("failed to read template file %s: %w", templateFile, err)
+		return nil, err
+	}
+
+	var content bytes.Buffer
+	if err := tmpl.Execute(&content, data); err != nil {
+		return nil, fmt.Errorf("failed to execute template: %w", err)
 	}
+	return &content, nil
+}
 
-	// Parse template
-	templateName := filepath.Base(templateFile)
-	tmpl, err := template.New(templateName).Funcs(funcMap).Parse(string(templateContent))
+// processTemplate reads template file, processes it with data, and writes output
+func processTemplate(templateFile, outputFile string, data *TemplateData, opts TemplateOptions) error {
+	content, err := renderTemplate(templateFile, data, opts)
 	if err != nil {
-		return fmt.Errorf("failed to parse template %s: %w", templateFile, err)
+		return err
 	}
 
 	// Determine output destination
@@ -162,10 +385,8 @@ func processTemplate(templateFile, outputFile string, data *TemplateData) error
 		log.Debugf("Writing template output to %s", outputFile)
 	}
 
-	// Execute template
-	err = tmpl.Execute(writer, data)
-	if err != nil {
-		return fmt.Errorf("failed to execute template: %w", err)
+	if _, err := content.WriteTo(writer); err != nil {
+		return fmt.Errorf("failed to write template output: %w", err)
 	}
 
 	// Log success
@@ -180,4 +401,15 @@ func processTemplate(templateFile, outputFile string, data *TemplateData) error
 
 func init() {
 	rootCmd.AddCommand(WriteCmd)
-}
\ No newline at end of file
+
+	WriteCmd.Flags().Bool("strict", false, "Fail on missing configuration keys")
+	_ = viper.BindPFlag("strict", WriteCmd.Flags().Lookup("strict"))
+
+	WriteCmd.Flags().Bool("reproducible", false, "Derive timestamp and engineer from the data")
+	_ = viper.BindPFlag("reproducible", WriteCmd.Flags().Lookup("reproducible"))
+
+	WriteCmd.Flags().BoolP("force", "f", false, "Overwrite output files modified outside scmt")
+	WriteCmd.Flags().String("data", "", "Render with another scmt data file")
+	WriteCmd.Flags().StringArray("set", []string{}, "Override a configuration value (KEY=VALUE)")
+	WriteCmd.Flags().StringSlice("role", []string{}, "Add a role for this render")
+}
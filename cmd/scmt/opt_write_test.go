@@ -5,9 +5,13 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jvzantvoort/scmt/config"
 	"github.com/jvzantvoort/scmt/data"
+	"github.com/jvzantvoort/scmt/state"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
 )
 
 func TestWriteCommand_Integration(t *testing.T) {
@@ -171,7 +175,7 @@ func TestPrepareTemplateData(t *testing.T) {
 	defer func() { Engineer = originalEngineer }()
 
 	// Test prepareTemplateData
-	templateData, err := prepareTemplateData(d)
+	templateData, err := prepareTemplateData(d, Engineer, false)
 	if err != nil {
 		t.Fatalf("Failed to prepare template data: %v", err)
 	}
@@ -193,6 +197,13 @@ func TestPrepareTemplateData(t *testing.T) {
 		t.Error("Expected non-empty timestamp")
 	}
 
+	if templateData.facts != nil {
+		t.Error("Expected facts not to be gathered before use")
+	}
+	if templateData.Facts().CPUCount < 1 || templateData.facts == nil {
+		t.Errorf("Expected facts to be gathered on use, got %+v", templateData.Facts())
+	}
+
 	// Test HasRole function
 	if !templateData.HasRole("test-role") {
 		t.Error("Expected HasRole('test-role') to return true")
@@ -202,6 +213,42 @@ func TestPrepareTemplateData(t *testing.T) {
 	}
 }
 
+func TestPrepareTemplateData_RoleDefaults(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		Configdir:      tmpDir,
+		ConfigDatafile: filepath.Join(tmpDir, "data.json"),
+		Catalogfile:    filepath.Join(tmpDir, "catalog.json"),
+		Logfile:        filepath.Join(tmpDir, "test.log"),
+	}
+	catalog := `{"roles": {"database": {"options": {"DB_PORT": "5432", "BACKUP_WINDOW": "02:00"}}}}`
+	if err := os.WriteFile(cfg.Catalogfile, []byte(catalog), 0644); err != nil {
+		t.Fatalf("Failed to write catalog: %v", err)
+	}
+
+	d, err := data.New(*cfg)
+	if err != nil {
+		t.Fatalf("Failed to create data: %v", err)
+	}
+	if _, err := d.AddRole("database", "testuser", "test"); err != nil {
+		t.Fatalf("Failed to add role: %v", err)
+	}
+	if _, err := d.Set("BACKUP_WINDOW", "03:00", "testuser", "test"); err != nil {
+		t.Fatalf("Failed to set test data: %v", err)
+	}
+
+	templateData, err := prepareTemplateData(d, Engineer, false)
+	if err != nil {
+		t.Fatalf("Failed to prepare template data: %v", err)
+	}
+	if templateData.Config["DB_PORT"] != "5432" {
+		t.Errorf("Expected DB_PORT from the role default, got '%s'", templateData.Config["DB_PORT"])
+	}
+	if templateData.Config["BACKUP_WINDOW"] != "03:00" {
+		t.Errorf("Expected the explicit BACKUP_WINDOW, got '%s'", templateData.Config["BACKUP_WINDOW"])
+	}
+}
+
 func TestTemplateData_HasRole(t *testing.T) {
 	td := TemplateData{
 		Roles: []string{"web-server", "database", "monitoring"},
@@ -228,4 +275,353 @@ func TestTemplateData_HasRole(t *testing.T) {
 	if emptyTd.HasRole("any-role") {
 		t.Error("Expected HasRole to return false for empty roles")
 	}
-}
\ No newline at end of file
+}
+
+func TestWriteCommand_Strict(t *testing.T) {
+	setupTestEnvironment(t)
+	initializeTestData(t)
+
+	viper.Set("strict", true)
+	defer viper.Set("strict", false)
+
+	tmpDir := t.TempDir()
+	templateFile := filepath.Join(tmpDir, "strict.template")
+	templateContent := "Type: {{.Config.TYPE}}\nTypo: {{.Config.TYPO}}\n"
+
+	err := os.WriteFile(templateFile, []byte(templateContent), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create template file: %v", err)
+	}
+
+	outputFile := filepath.Join(tmpDir, "output.txt")
+	err = WriteCmd.RunE(WriteCmd, []string{templateFile, outputFile})
+	if err == nil {
+		t.Fatal("Expected error for missing key in strict mode")
+	}
+	if !strings.Contains(err.Error(), "strict.template:2:") {
+		t.Errorf("Expected error to name template line 2, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "TYPO") {
+		t.Errorf("Expected error to name the missing key, got: %v", err)
+	}
+
+	// A failed render must not leave an output file behind
+	if _, err := os.Stat(outputFile); !os.IsNotExist(err) {
+		t.Error("Output file should not be created when rendering fails")
+	}
+}
+
+func TestWriteCommand_Required(t *testing.T) {
+	setupTestEnvironment(t)
+	initializeTestData(t)
+
+	tmpDir := t.TempDir()
+	templateFile := filepath.Join(tmpDir, "required.template")
+	templateContent := "Owner: {{required \"OWNER\"}}\nHost: {{required \"DB_HOST\"}}\n"
+
+	err := os.WriteFile(templateFile, []byte(templateContent), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create template file: %v", err)
+	}
+
+	err = WriteCmd.RunE(WriteCmd, []string{templateFile})
+	if err == nil {
+		t.Fatal("Expected error for missing required key")
+	}
+	if !strings.Contains(err.Error(), "required.template:2:") {
+		t.Errorf("Expected error to name template line 2, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), `required configuration key "DB_HOST" is not set`) {
+		t.Errorf("Expected required key error, got: %v", err)
+	}
+}
+
+func TestTemplateData_Required(t *testing.T) {
+	td := TemplateData{
+		Config: map[string]string{"OWNER": "Mad House", "EMPTY": ""},
+	}
+
+	value, err := td.Required("OWNER")
+	if err != nil {
+		t.Fatalf("Expected no error for existing key, got: %v", err)
+	}
+	if value != "Mad House" {
+		t.Errorf("Expected 'Mad House', got '%s'", value)
+	}
+
+	if _, err := td.Required("EMPTY"); err == nil {
+		t.Error("Expected error for empty key")
+	}
+	if _, err := td.Required("MISSING"); err == nil {
+		t.Error("Expected error for missing key")
+	}
+}
+
+func TestWriteCommand_DataFileAndOverrides(t *testing.T) {
+	tmpDir := setupTestEnvironment(t)
+	initializeTestData(t)
+
+	// Data file of another server, created with its own log
+	otherDir := t.TempDir()
+	otherCfg := config.Config{
+		Configdir:      otherDir,
+		ConfigDatafile: filepath.Join(otherDir, "web02.json"),
+		Logfile:        filepath.Join(otherDir, "other.log"),
+	}
+	other, err := data.New(otherCfg)
+	if err != nil {
+		t.Fatalf("Failed to create data: %v", err)
+	}
+	_, _ = other.Set("TYPE", "appliance", "testuser", "test")
+	_, _ = other.Set("OWNER", "Other Team", "testuser", "test")
+	_, _ = other.AddRole("database", "testuser", "test")
+	if err := other.Save(); err != nil {
+		t.Fatalf("Failed to save other data: %v", err)
+	}
+
+	templateFile := filepath.Join(t.TempDir(), "preview.template")
+	templateContent := `{{.Config.TYPE}} {{.Config.OWNER}} {{.Config.EXTRA}} {{join .Roles ","}} [{{.Facts.Hostname}}]`
+	if err := os.WriteFile(templateFile, []byte(templateContent), 0644); err != nil {
+		t.Fatalf("Failed to create template file: %v", err)
+	}
+
+	flags := WriteCmd.Flags()
+	if err := flags.Set("data", otherCfg.ConfigDatafile); err != nil {
+		t.Fatalf("Failed to set data flag: %v", err)
+	}
+	_ = flags.Set("set", "OWNER=Fleet Team")
+	_ = flags.Set("set", "EXTRA=a=b")
+	_ = flags.Set("role", "web-server,database")
+	defer func() {
+		_ = flags.Set("data", "")
+		_ = flags.Lookup("set").Value.(pflag.SliceValue).Replace([]string{})
+		_ = flags.Lookup("role").Value.(pflag.SliceValue).Replace([]string{})
+	}()
+
+	outputFile := filepath.Join(t.TempDir(), "web02.conf")
+	if err := WriteCmd.RunE(WriteCmd, []string{templateFile, outputFile}); err != nil {
+		t.Fatalf("Failed to render with other data file: %v", err)
+	}
+
+	content, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	expected := "appliance Fleet Team a=b database,web-server []"
+	if string(content) != expected {
+		t.Errorf("Expected %q, got %q", expected, string(content))
+	}
+
+	// Neither data file was modified, and nothing was tracked or audited
+	reloaded, _ := data.New(otherCfg)
+	if err := reloaded.Open(); err != nil {
+		t.Fatalf("Failed to reopen other data: %v", err)
+	}
+	if value, _ := reloaded.Get("OWNER"); value.Value != "Other Team" {
+		t.Errorf("Expected other data file to be unchanged, got OWNER=%s", value.Value)
+	}
+	if reloaded.HasRole("web-server") {
+		t.Error("Expected other data file roles to be unchanged")
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "state.json")); !os.IsNotExist(err) {
+		t.Error("Expected no state to be recorded for a preview render")
+	}
+	logContent, _ := os.ReadFile(filepath.Join(tmpDir, "test.log"))
+	if strings.Contains(string(logContent), "TEMPLATE_WRITE") {
+		t.Error("Expected no audit record for a preview render")
+	}
+
+	// A preview does not overwrite a file scmt tracks without --force
+	st, _ := state.New(filepath.Join(tmpDir, "state.json"))
+	st.Record(outputFile, templateFile, state.Checksum([]byte("tracked")), "testuser")
+	if err := st.Save(); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+	if err := os.WriteFile(outputFile, []byte("tracked"), 0644); err != nil {
+		t.Fatalf("Failed to write output file: %v", err)
+	}
+	if err := WriteCmd.RunE(WriteCmd, []string{templateFile, outputFile}); err == nil {
+		t.Error("Expected a preview of a tracked file to be refused")
+	}
+	if content, _ := os.ReadFile(outputFile); string(content) != "tracked" {
+		t.Errorf("Expected the tracked file to be unchanged, got %q", content)
+	}
+
+	_ = flags.Set("force", "true")
+	defer func() { _ = flags.Set("force", "false") }()
+	if err := WriteCmd.RunE(WriteCmd, []string{templateFile, outputFile}); err != nil {
+		t.Fatalf("Expected --force to overwrite the tracked file: %v", err)
+	}
+	if content, _ := os.ReadFile(outputFile); string(content) != expected {
+		t.Errorf("Expected the preview with --force, got %q", content)
+	}
+}
+
+func TestTemplateData_Override(t *testing.T) {
+	td := &TemplateData{
+		Config: map[string]string{"OWNER": "Mad House"},
+		Roles:  []string{"web-server"},
+	}
+
+	if err := td.Override([]string{"OWNER=Ops", "NEW="}, []string{"web-server", "cache"}); err != nil {
+		t.Fatalf("Failed to apply overrides: %v", err)
+	}
+	if td.Config["OWNER"] != "Ops" {
+		t.Errorf("Expected OWNER 'Ops', got '%s'", td.Config["OWNER"])
+	}
+	if value, ok := td.Config["NEW"]; !ok || value != "" {
+		t.Errorf("Expected NEW to be set to empty, got %q (%t)", value, ok)
+	}
+	if len(td.Roles) != 2 || td.Roles[0] != "cache" || td.Roles[1] != "web-server" {
+		t.Errorf("Expected sorted roles [cache web-server], got %v", td.Roles)
+	}
+
+	for _, invalid := range []string{"NOVALUE", "=value"} {
+		if err := td.Override([]string{invalid}, nil); err == nil {
+			t.Errorf("Expected error for override %q", invalid)
+		}
+	}
+}
+
+func TestPrepareTemplateData_Reproducible(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		Configdir:      tmpDir,
+		ConfigDatafile: filepath.Join(tmpDir, "data.json"),
+		Logfile:        filepath.Join(tmpDir, "test.log"),
+	}
+
+	d, err := data.New(*cfg)
+	if err != nil {
+		t.Fatalf("Failed to create data: %v", err)
+	}
+	_, _ = d.Set("FIRST", "1", "alice", "test")
+	_, _ = d.Set("SECOND", "2", "bob", "test")
+	_, _ = d.AddRole("web-server", "alice", "test")
+	_, _ = d.AddRole("database", "alice", "test")
+
+	// Pin the change times so the expected values are known
+	d.Elements[0].Value.Changed = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	d.Elements[1].Value.Changed = time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	d.Roles[0].Added = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	d.Roles[1].Added = time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	originalEngineer := Engineer
+	Engineer = "current-user"
+	defer func() { Engineer = originalEngineer }()
+
+	td, err := prepareTemplateData(d, Engineer, true)
+	if err != nil {
+		t.Fatalf("Failed to prepare template data: %v", err)
+	}
+
+	if td.LastChanged != "2024-05-06 07:08:09" {
+		t.Errorf("Expected LastChanged '2024-05-06 07:08:09', got '%s'", td.LastChanged)
+	}
+	if td.LastEngineer != "bob" {
+		t.Errorf("Expected LastEngineer 'bob', got '%s'", td.LastEngineer)
+	}
+	if td.Timestamp != td.LastChanged {
+		t.Errorf("Expected Timestamp to equal LastChanged, got '%s'", td.Timestamp)
+	}
+	if td.Engineer != "bob" {
+		t.Errorf("Expected Engineer 'bob' in reproducible mode, got '%s'", td.Engineer)
+	}
+	if td.Now("2006") != "2024" {
+		t.Errorf("Expected now to use the reproducible time, got '%s'", td.Now("2006"))
+	}
+	if len(td.Roles) != 2 || td.Roles[0] != "database" || td.Roles[1] != "web-server" {
+		t.Errorf("Expected sorted roles [database web-server], got %v", td.Roles)
+	}
+
+	// SOURCE_DATE_EPOCH takes precedence over the data
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	td, err = prepareTemplateData(d, Engineer, true)
+	if err != nil {
+		t.Fatalf("Failed to prepare template data: %v", err)
+	}
+	if td.Timestamp != "2023-11-14 22:13:20" {
+		t.Errorf("Expected Timestamp from SOURCE_DATE_EPOCH, got '%s'", td.Timestamp)
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	if _, err := prepareTemplateData(d, Engineer, true); err == nil {
+		t.Error("Expected error for invalid SOURCE_DATE_EPOCH")
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+	os.Unsetenv("SOURCE_DATE_EPOCH")
+
+	// Roles count as changes
+	d.Roles[1].Added = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	d.Roles[1].Engineer = "carol"
+	td, err = prepareTemplateData(d, Engineer, true)
+	if err != nil {
+		t.Fatalf("Failed to prepare template data: %v", err)
+	}
+	if td.Timestamp != "2024-06-01 00:00:00" || td.Engineer != "carol" {
+		t.Errorf("Expected the role addition as latest change, got '%s' by '%s'", td.Timestamp, td.Engineer)
+	}
+
+	// Data without changes uses the Unix epoch, not the clock
+	empty, _ := data.New(*cfg)
+	td, err = prepareTemplateData(empty, Engineer, true)
+	if err != nil {
+		t.Fatalf("Failed to prepare template data: %v", err)
+	}
+	if td.Timestamp != "1970-01-01 00:00:00" {
+		t.Errorf("Expected the Unix epoch for empty data, got '%s'", td.Timestamp)
+	}
+
+	// Outside reproducible mode the current engineer is used
+	td, err = prepareTemplateData(d, Engineer, false)
+	if err != nil {
+		t.Fatalf("Failed to prepare template data: %v", err)
+	}
+	if td.Engineer != "current-user" {
+		t.Errorf("Expected Engineer 'current-user', got '%s'", td.Engineer)
+	}
+	if td.LastEngineer != "carol" {
+		t.Errorf("Expected LastEngineer 'carol', got '%s'", td.LastEngineer)
+	}
+}
+
+func TestWriteCommand_Reproducible(t *testing.T) {
+	setupTestEnvironment(t)
+	initializeTestData(t)
+
+	viper.Set("reproducible", true)
+	defer viper.Set("reproducible", false)
+
+	tmpDir := t.TempDir()
+	templateFile := filepath.Join(tmpDir, "repro.template")
+	templateContent := "# {{.Timestamp}} {{.Engineer}} {{now \"2006-01-02T15:04:05\"}}\n{{range .Roles}}{{.}} {{end}}\n"
+	if err := os.WriteFile(templateFile, []byte(templateContent), 0644); err != nil {
+		t.Fatalf("Failed to create template file: %v", err)
+	}
+
+	// Render at two different times
+	renderTimes := []time.Time{
+		time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC),
+	}
+	defer func() { timeNow = time.Now }()
+
+	outputs := []string{}
+	for i, name := range []string{"first.conf", "second.conf"} {
+		timeNow = func() time.Time { return renderTimes[i] }
+		outputFile := filepath.Join(tmpDir, name)
+		if err := WriteCmd.RunE(WriteCmd, []string{templateFile, outputFile}); err != nil {
+			t.Fatalf("Failed to render template %d: %v", i, err)
+		}
+		content, err := os.ReadFile(outputFile)
+		if err != nil {
+			t.Fatalf("Failed to read output file: %v", err)
+		}
+		outputs = append(outputs, string(content))
+	}
+
+	if outputs[0] != outputs[1] {
+		t.Errorf("Expected identical renders, got:\n%s\n%s", outputs[0], outputs[1])
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jvzantvoort/scmt/config"
+	"github.com/jvzantvoort/scmt/data"
+	"github.com/jvzantvoort/scmt/state"
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+)
+
+// Status of a file handled for a role
+const (
+	RoleFileWritten string = "written"
+	RoleFileFailed  string = "failed"
+	RoleFileRemoved string = "removed"
+	RoleFileKept    string = "kept"
+)
+
+// RoleFile describes a file rendered from, or removed for, a role template
+type RoleFile struct {
+	Role        string `json:"role"`
+	Template    string `json:"template"`
+	Destination string `json:"destination"`
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+}
+
+// roleTemplateDir returns the directory holding the templates of role,
+// <configdir>/roles/<role>/templates
+func roleTemplateDir(cfg *config.Config, role string) (string, error) {
+	if role == "" || role == "." || role == ".." || strings.ContainsRune(role, filepath.Separator) {
+		return "", fmt.Errorf("invalid role name %q", role)
+	}
+	return filepath.Join(cfg.Rolesdir, role, "templates"), nil
+}
+
+// roleFiles lists the templates of role. The path of a template below the
+// role template directory is its destination below the root directory, so
+// roles/web-server/templates/etc/nginx/nginx.conf renders /etc/nginx/nginx.conf.
+func roleFiles(cfg *config.Config, role string) ([]RoleFile, error) {
+	dir, err := roleTemplateDir(cfg, role)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := libraryFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read role templates %s: %w", dir, err)
+	}
+
+	retv := []RoleFile{}
+	for relpath, path := range files {
+		retv = append(retv, RoleFile{
+			Role:        role,
+			Template:    path,
+			Destination: filepath.Join(cfg.Rootdir, filepath.FromSlash(relpath)),
+		})
+	}
+	sort.Slice(retv, func(i, j int) bool {
+		return retv[i].Destination < retv[j].Destination
+	})
+	return retv, nil
+}
+
+// roleTemplateKey is the key a role template is authorized by in the API,
+// the role and the destination below the root directory, like
+// web-server/etc/nginx/nginx.conf
+func roleTemplateKey(cfg *config.Config, file RoleFile) string {
+	relpath, err := filepath.Rel(cfg.Rootdir, file.Destination)
+	if err != nil {
+		relpath = file.Destination
+	}
+	return file.Role + "/" + filepath.ToSlash(relpath)
+}
+
+// applyRoles renders the templates of every given role on behalf of
+// engineer
+func applyRoles(cfg *config.Config, d *data.Data, roles []string, engineer string, force bool) ([]RoleFile, error) {
+	opts := newTemplateOptions(cfg)
+
+	templateData, err := prepareTemplateData(d, engineer, cfg.Reproducible)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare template data: %w", err)
+	}
+
+	st, err := state.New(cfg.Statefile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+
+	retv := []RoleFile{}
+	failed := 0
+	for _, role := range roles {
+		files, err := roleFiles(cfg, role)
+		if err != nil {
+			return retv, err
+		}
+		for _, file := range files {
+			file.Status = RoleFileWritten
+			if err := renderFile(d, st, file.Template, file.Destination, templateData, opts, engineer, force); err != nil {
+				log.Errorf("Failed to render %s: %v", file.Destination, err)
+				file.Status = RoleFileFailed
+				file.Error = err.Error()
+				failed++
+			}
+			retv = append(retv, file)
+		}
+	}
+
+	if failed > 0 {
+		return retv, fmt.Errorf("%d of %d role templates failed to render", failed, len(retv))
+	}
+	return retv, nil
+}
+
+// purgeRole removes the files rendered from the templates of role on behalf
+// of engineer. Files modified outside scmt are kept unless force is set.
+func purgeRole(cfg *config.Config, d *data.Data, role, engineer string, force bool) ([]RoleFile, error) {
+	dir, err := roleTemplateDir(cfg, role)
+	if err != nil {
+		return nil, err
+	}
+	prefix, _ := filepath.Abs(dir)
+	prefix += string(filepath.Separator)
+
+	st, err := state.New(cfg.Statefile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+
+	retv := []RoleFile{}
+	for _, entry := range append([]state.Entry{}, st.Entries...) {
+		if template, _ := filepath.Abs(entry.Template); !strings.HasPrefix(template, prefix) {
+			continue
+		}
+		file := RoleFile{Role: role, Template: entry.Template, Destination: entry.Path}
+
+		status, err := st.Check(entry.Path)
+		if err != nil {
+			return retv, fmt.Errorf("failed to check %s for drift: %w", entry.Path, err)
+		}
+		if status == state.StatusModified && !force {
+			file.Status = RoleFileKept
+			file.Error = "modified outside scmt, use --force to remove"
+			retv = append(retv, file)
+			continue
+		}
+
+		// The pre- hooks may veto the removal, the file is kept then
+		message := fmt.Sprintf("Role removed: %s", role)
+		if err := d.PreChange("TEMPLATE_REMOVE", entry.Path, "", engineer, message); err != nil {
+			file.Status = RoleFileKept
+			file.Error = err.Error()
+			retv = append(retv, file)
+			continue
+		}
+
+		if err := os.Remove(entry.Path); err != nil && !os.IsNotExist(err) {
+			return retv, fmt.Errorf("failed to remove %s: %w", entry.Path, err)
+		}
+		st.Remove(entry.Path)
+		if err := d.LogRemoval("TEMPLATE_REMOVE", entry.Path, engineer, message); err != nil {
+			log.Warnf("Failed to log template removal: %v", err)
+		}
+		file.Status = RoleFileRemoved
+		retv = append(retv, file)
+	}
+
+	// The files are removed, the removals are committed
+	d.RunPostHooks()
+
+	if err := st.Save(); err != nil {
+		return retv, fmt.Errorf("failed to save state: %w", err)
+	}
+	return retv, nil
+}
+
+// printRoleFiles writes the role files as a table, or as JSON with --json
+func printRoleFiles(files []RoleFile) error {
+	if OutputJSON {
+		jsonBytes, _ := json.MarshalIndent(files, "", "  ")
+		fmt.Println(string(jsonBytes))
+		return nil
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.Header([]string{"Role", "Destination", "Status", "Error"})
+	tabledata := [][]string{}
+	for _, file := range files {
+		tabledata = append(tabledata, []string{file.Role, file.Destination, file.Status, file.Error})
+	}
+	if err := table.Bulk(tabledata); err != nil {
+		return err
+	}
+	return table.Render()
+}
@@ -82,6 +82,12 @@ func init() {
 	rootCmd.PersistentFlags().StringP("message", "M", "", "Specify message")
 	_ = viper.BindPFlag("message", rootCmd.PersistentFlags().Lookup("message"))
 
+	rootCmd.PersistentFlags().StringP("templatedir", "T", "", "Template library directories, separated by ':'")
+	_ = viper.BindPFlag("templatedir", rootCmd.PersistentFlags().Lookup("templatedir"))
+
+	rootCmd.PersistentFlags().StringP("rootdir", "R", "", "Root directory for files rendered from role templates")
+	_ = viper.BindPFlag("rootdir", rootCmd.PersistentFlags().Lookup("rootdir"))
+
 	rootCmd.PersistentFlags().BoolP("json", "J", false, "JSON Output")
 	_ = viper.BindPFlag("json", rootCmd.PersistentFlags().Lookup("json"))
 
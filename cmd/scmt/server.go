@@ -0,0 +1,542 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/jvzantvoort/scmt/config"
+	"github.com/jvzantvoort/scmt/data"
+	"github.com/jvzantvoort/scmt/logger"
+	"github.com/jvzantvoort/scmt/notify"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxRequestBody limits the size of API request bodies
+const maxRequestBody int64 = 1 << 20
+
+// APIChange is the body of a request changing an element, the message is
+// recorded in the audit log like -M of the CLI with the caller as engineer
+type APIChange struct {
+	Value   string `json:"value"`
+	Message string `json:"message"`
+}
+
+// APIRole is the body of a request adding a role
+type APIRole struct {
+	Role        string            `json:"role"`
+	Description string            `json:"description"`
+	Parameters  map[string]string `json:"parameters"`
+	Message     string            `json:"message"`
+}
+
+// APIRender is the body of a request rendering a template from the library
+type APIRender struct {
+	Template string `json:"template"`
+}
+
+// apiError is an error with the HTTP status it is answered with
+type apiError struct {
+	status int
+	err    error
+}
+
+func (e apiError) Error() string {
+	return e.err.Error()
+}
+
+// newAPIError returns an error answered with status
+func newAPIError(status int, format string, args ...interface{}) error {
+	return apiError{status: status, err: fmt.Errorf(format, args...)}
+}
+
+// APIServer answers the HTTP/JSON API of scmt serve. Every request reads the
+// data file afresh and changes hold the data lock from reading to saving,
+// exactly like the CLI, so the server and the CLI can be used side by side.
+// Callers are authorized against the tokens file, see authenticate.
+type APIServer struct {
+	Config *config.Config
+}
+
+// Handler returns the routes of the API
+func (s *APIServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/elements", s.handle(s.listElements))
+	mux.HandleFunc("GET /v1/elements/{option}", s.handle(s.getElement))
+	mux.HandleFunc("PUT /v1/elements/{option}", s.handle(s.setElement))
+	mux.HandleFunc("DELETE /v1/elements/{option}", s.handle(s.unsetElement))
+	mux.HandleFunc("GET /v1/roles", s.handle(s.listRoles))
+	mux.HandleFunc("POST /v1/roles", s.handle(s.addRole))
+	mux.HandleFunc("DELETE /v1/roles/{role}", s.handle(s.removeRole))
+	mux.HandleFunc("GET /v1/log", s.handle(s.listLog))
+	mux.HandleFunc("POST /v1/render", s.render)
+	return mux
+}
+
+// handle answers a request with the JSON encoded result of fn, or with the
+// error it returns
+func (s *APIServer) handle(fn func(r *http.Request) (int, interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, result, err := fn(r)
+		if err != nil {
+			writeAPIError(w, r, err)
+			return
+		}
+		writeAPIResult(w, r, status, result)
+	}
+}
+
+// writeAPIResult writes result as indented JSON
+func writeAPIResult(w http.ResponseWriter, r *http.Request, status int, result interface{}) {
+	content, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "%s\n", string(content))
+	log.Infof("%s %s: %d", r.Method, r.URL.Path, status)
+}
+
+// writeAPIError writes err as {"error": "..."}, with the status of an
+// apiError or 500 for other errors
+func writeAPIError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	var aerr apiError
+	if errors.As(err, &aerr) {
+		status = aerr.status
+	}
+
+	content, _ := json.MarshalIndent(map[string]string{"error": err.Error()}, "", "  ")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "%s\n", string(content))
+	log.Warnf("%s %s: %d %v", r.Method, r.URL.Path, status, err)
+}
+
+// decodeBody decodes the JSON body of a request into target
+func decodeBody(r *http.Request, target interface{}) error {
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxRequestBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
+		return newAPIError(http.StatusBadRequest, "failed to parse request: %w", err)
+	}
+	return nil
+}
+
+// requireMessage refuses changes without a message
+func requireMessage(message string) error {
+	if message == "" {
+		return newAPIError(http.StatusBadRequest, "message is required")
+	}
+	return nil
+}
+
+// open reads the data file
+func (s *APIServer) open() (*data.Data, error) {
+	d, err := data.New(*s.Config)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.Open(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.Config.ConfigDatafile, err)
+	}
+	return d, nil
+}
+
+// change reads the data file under the data lock, applies fn and saves the
+// data when fn reports a change. then, when not nil, runs with the saved
+// data before the lock is released.
+func (s *APIServer) change(fn func(d *data.Data) (bool, error), then func(d *data.Data)) (*data.Data, error) {
+	d, err := data.New(*s.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := d.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err := d.Open(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.Config.ConfigDatafile, err)
+	}
+
+	changed, err := fn(d)
+	var veto *notify.VetoError
+	if errors.As(err, &veto) {
+		return nil, apiError{status: http.StatusConflict, err: err}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		if err := d.Save(); err != nil {
+			return nil, err
+		}
+	}
+	if then != nil {
+		then(d)
+	}
+	return d, nil
+}
+
+// listElements answers GET /v1/elements with the effective configuration
+func (s *APIServer) listElements(r *http.Request) (int, interface{}, error) {
+	caller, err := s.authorizeAny(r, OperationRead)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	d, err := s.open()
+	if err != nil {
+		return 0, nil, err
+	}
+	values, err := d.Effective()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Only the options the caller may read are listed
+	retv := []data.EffectiveValue{}
+	for _, value := range values {
+		if caller.Allowed(OperationRead, value.Option) {
+			retv = append(retv, value)
+		}
+	}
+	return http.StatusOK, retv, nil
+}
+
+// getElement answers GET /v1/elements/{option} with the effective value
+func (s *APIServer) getElement(r *http.Request) (int, interface{}, error) {
+	option := r.PathValue("option")
+	if _, err := s.authorize(r, OperationRead, option); err != nil {
+		return 0, nil, err
+	}
+
+	d, err := s.open()
+	if err != nil {
+		return 0, nil, err
+	}
+	value, err := d.GetEffective(option)
+	if err != nil {
+		return 0, nil, apiError{status: http.StatusNotFound, err: err}
+	}
+	return http.StatusOK, value, nil
+}
+
+// setElement answers PUT /v1/elements/{option} by setting the option
+func (s *APIServer) setElement(r *http.Request) (int, interface{}, error) {
+	option := r.PathValue("option")
+
+	var request APIChange
+	if err := decodeBody(r, &request); err != nil {
+		return 0, nil, err
+	}
+	if err := requireMessage(request.Message); err != nil {
+		return 0, nil, err
+	}
+	caller, err := s.authorize(r, OperationSet, option)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	changed := false
+	_, err = s.change(func(d *data.Data) (bool, error) {
+		var err error
+		changed, err = d.Set(option, request.Value, caller.Name, request.Message)
+		return changed, err
+	}, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, map[string]interface{}{
+		"option":  option,
+		"value":   request.Value,
+		"changed": changed,
+	}, nil
+}
+
+// unsetElement answers DELETE /v1/elements/{option} by removing the option
+func (s *APIServer) unsetElement(r *http.Request) (int, interface{}, error) {
+	option := r.PathValue("option")
+
+	var request APIChange
+	if err := decodeBody(r, &request); err != nil {
+		return 0, nil, err
+	}
+	if err := requireMessage(request.Message); err != nil {
+		return 0, nil, err
+	}
+	caller, err := s.authorize(r, OperationSet, option)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	_, err = s.change(func(d *data.Data) (bool, error) {
+		if _, err := d.Get(option); err != nil {
+			return false, apiError{status: http.StatusNotFound, err: err}
+		}
+		return d.Unset(option, caller.Name, request.Message)
+	}, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, map[string]interface{}{
+		"option":  option,
+		"changed": true,
+	}, nil
+}
+
+// listRoles answers GET /v1/roles with the assigned roles the caller may
+// read-role
+func (s *APIServer) listRoles(r *http.Request) (int, interface{}, error) {
+	caller, err := s.authorizeAny(r, OperationReadRole)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	d, err := s.open()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	retv := []data.Role{}
+	for _, role := range d.Roles {
+		if caller.Allowed(OperationReadRole, role.Name) {
+			retv = append(retv, role)
+		}
+	}
+	return http.StatusOK, retv, nil
+}
+
+// addRole answers POST /v1/roles by adding the role and the roles it
+// requires, and rendering their templates like scmt role add
+func (s *APIServer) addRole(r *http.Request) (int, interface{}, error) {
+	var request APIRole
+	if err := decodeBody(r, &request); err != nil {
+		return 0, nil, err
+	}
+	if request.Role == "" {
+		return 0, nil, newAPIError(http.StatusBadRequest, "role is required")
+	}
+	if err := requireMessage(request.Message); err != nil {
+		return 0, nil, err
+	}
+	caller, err := s.authorize(r, OperationRole, request.Role)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	role := data.Role{
+		Name:        request.Role,
+		Description: request.Description,
+		Parameters:  request.Parameters,
+	}
+
+	// The caller needs the role permission on every role added, required
+	// roles included, and write-template on every template they render.
+	// The templates render before the lock is released.
+	var added []string
+	var files []RoleFile
+	var renderErr error
+	var deniedOperation, deniedKey string
+	_, err = s.change(func(d *data.Data) (bool, error) {
+		planned, err := d.PlanRoles([]data.Role{role})
+		if err != nil {
+			return false, apiError{status: http.StatusConflict, err: err}
+		}
+		deniedOperation, deniedKey, err = s.authorizeRoles(caller, planned)
+		if err != nil {
+			return false, err
+		}
+
+		added, err = d.AddRoleEntries([]data.Role{role}, caller.Name, request.Message)
+		if err != nil {
+			return false, apiError{status: http.StatusConflict, err: err}
+		}
+		return len(added) > 0, nil
+	}, func(d *data.Data) {
+		files, renderErr = applyRoles(s.Config, d, added, caller.Name, false)
+	})
+	if deniedOperation != "" {
+		s.recordDenied(r, caller.Name, deniedOperation, deniedKey)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	status := http.StatusOK
+	if len(added) > 0 {
+		status = http.StatusCreated
+	}
+	result := map[string]interface{}{
+		"changes": roleChanges([]string{request.Role}, added, nil),
+		"files":   files,
+	}
+	if renderErr != nil {
+		result["error"] = renderErr.Error()
+	}
+	return status, result, nil
+}
+
+// removeRole answers DELETE /v1/roles/{role} by removing the role
+func (s *APIServer) removeRole(r *http.Request) (int, interface{}, error) {
+	role := r.PathValue("role")
+
+	var request APIChange
+	if err := decodeBody(r, &request); err != nil {
+		return 0, nil, err
+	}
+	if err := requireMessage(request.Message); err != nil {
+		return 0, nil, err
+	}
+	caller, err := s.authorize(r, OperationRole, role)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	_, err = s.change(func(d *data.Data) (bool, error) {
+		if !d.HasRole(role) {
+			return false, newAPIError(http.StatusNotFound, "role %s not found", role)
+		}
+		changed, err := d.RemoveRole(role, caller.Name, request.Message)
+		if err != nil {
+			return false, apiError{status: http.StatusConflict, err: err}
+		}
+		return changed, nil
+	}, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, map[string]interface{}{
+		"changes": roleChanges(nil, nil, []string{role}),
+	}, nil
+}
+
+// listLog answers GET /v1/log with the audit log, newest first, of a single
+// option with ?option=. Only the records of options the caller may read are
+// listed, removals only when the caller may read the removed option as well.
+func (s *APIServer) listLog(r *http.Request) (int, interface{}, error) {
+	option := r.URL.Query().Get("option")
+
+	var caller *APICaller
+	var err error
+	if option != "" {
+		caller, err = s.authorize(r, OperationRead, option)
+	} else {
+		caller, err = s.authorizeAny(r, OperationRead)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	logh, err := logger.New(s.Config.Logfile)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read %s: %w", s.Config.Logfile, err)
+	}
+
+	selected := logh.Records
+	if option != "" {
+		selected = logh.Select(option)
+	}
+
+	records := []logger.Record{}
+	for _, record := range selected {
+		if !caller.Allowed(OperationRead, record.Option) {
+			continue
+		}
+		// A removal holds the removed option and its value, KEY=VALUE
+		if record.Option == data.OptionRemoveOption {
+			if key, _, _ := strings.Cut(record.Value, "="); !caller.Allowed(OperationRead, key) {
+				continue
+			}
+		}
+		records = append(records, record)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Changed.After(records[j].Changed)
+	})
+	return http.StatusOK, records, nil
+}
+
+// render answers POST /v1/render with a template of the library rendered
+// like scmt write renders it to stdout
+func (s *APIServer) render(w http.ResponseWriter, r *http.Request) {
+	var request APIRender
+	if err := decodeBody(r, &request); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	caller, err := s.authorize(r, OperationWriteTemplate, request.Template)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+
+	opts := newTemplateOptions(s.Config)
+	templateFile, err := libraryTemplate(request.Template, opts.SearchPath)
+	if err != nil {
+		writeAPIError(w, r, apiError{status: http.StatusNotFound, err: err})
+		return
+	}
+
+	d, err := s.open()
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	templateData, err := prepareTemplateData(d, caller.Name, s.Config.Reproducible)
+	if err != nil {
+		writeAPIError(w, r, fmt.Errorf("failed to prepare template data: %w", err))
+		return
+	}
+
+	// The caller only renders the keys it may read, and never the
+	// environment of the server
+	for key := range templateData.Config {
+		if !caller.Allowed(OperationRead, key) {
+			delete(templateData.Config, key)
+		}
+	}
+	opts.NoEnv = true
+
+	content, err := renderTemplate(templateFile, templateData, opts)
+	if err != nil {
+		writeAPIError(w, r, apiError{status: http.StatusUnprocessableEntity, err: err})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = content.WriteTo(w)
+	log.Infof("%s %s: %d", r.Method, r.URL.Path, http.StatusOK)
+}
+
+// libraryTemplate returns the path of a template in the template library.
+// Unlike resolveTemplate it never accepts file paths, so API clients cannot
+// read arbitrary files through the server.
+func libraryTemplate(name string, searchPath []string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("template is required")
+	}
+	for _, dir := range searchPath {
+		files, err := libraryFiles(dir)
+		if err != nil {
+			return "", err
+		}
+		if path, found := files[name]; found {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("template %s not found in the template library", name)
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/jvzantvoort/scmt/data"
+	log "github.com/sirupsen/logrus"
+)
+
+// Operations API permissions are granted for
+const (
+	OperationRead          string = "read"
+	OperationSet           string = "set"
+	OperationReadRole      string = "read-role"
+	OperationRole          string = "role"
+	OperationWriteTemplate string = "write-template"
+)
+
+// DeniedOption is the audit log option of API requests that were refused
+const DeniedOption string = "API_DENIED"
+
+// APIPermission grants operations on the keys matching one of the patterns,
+// option names for read and set, role names for read-role and role and
+// template names for write-template. "*" grants every operation, no keys grant every key.
+type APIPermission struct {
+	Operations []string `json:"operations"`
+	Keys       []string `json:"keys,omitempty"`
+}
+
+// APIPrincipal is a unix user or a token and the permissions it holds
+type APIPrincipal struct {
+	Token       string          `json:"token,omitempty"`
+	Permissions []APIPermission `json:"permissions"`
+}
+
+// APITokens is the layout of the tokens file: the permissions of unix users
+// calling over the socket, keyed by user name, and of the bearer tokens
+// used over TCP, keyed by the name recorded as engineer
+type APITokens struct {
+	Users  map[string]APIPrincipal `json:"users"`
+	Tokens map[string]APIPrincipal `json:"tokens"`
+}
+
+// APICaller is the authenticated caller of a request
+type APICaller struct {
+	Name        string
+	Permissions []APIPermission
+}
+
+// allPermissions grants every operation on every key
+var allPermissions = []APIPermission{{Operations: []string{"*"}}}
+
+// peerKey is the context key of the peer of a unix socket connection
+type peerKey struct{}
+
+// apiPeer is the process on the other end of a unix socket connection
+type apiPeer struct {
+	uid int
+	err error
+}
+
+// apiConnContext records the peer of unix socket connections, used as
+// http.Server ConnContext
+func apiConnContext(ctx context.Context, conn net.Conn) context.Context {
+	if _, ok := conn.(*net.UnixConn); !ok {
+		return ctx
+	}
+	uid, err := peerUID(conn)
+	return context.WithValue(ctx, peerKey{}, apiPeer{uid: uid, err: err})
+}
+
+// loadAPITokens reads the tokens file, a missing file grants nothing. The
+// file holds secrets, so it may not be readable by others or writable by
+// anyone but its owner.
+func loadAPITokens(tokenfile string) (*APITokens, error) {
+	retv := &APITokens{Users: map[string]APIPrincipal{}, Tokens: map[string]APIPrincipal{}}
+
+	info, err := os.Stat(tokenfile)
+	if os.IsNotExist(err) {
+		return retv, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0026 != 0 {
+		return nil, fmt.Errorf("%s may not be readable by others or writable by group or others", tokenfile)
+	}
+
+	content, err := os.ReadFile(tokenfile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", tokenfile, err)
+	}
+	if err := json.Unmarshal(content, retv); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", tokenfile, err)
+	}
+	return retv, nil
+}
+
+// Allowed reports whether the caller may perform operation on key
+func (c APICaller) Allowed(operation, key string) bool {
+	for _, permission := range c.Permissions {
+		if permission.allows(operation, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedAny reports whether the caller may perform operation on any key
+func (c APICaller) AllowedAny(operation string) bool {
+	for _, permission := range c.Permissions {
+		for _, granted := range permission.Operations {
+			if granted == "*" || granted == operation {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allows reports whether the permission grants operation on key
+func (p APIPermission) allows(operation, key string) bool {
+	granted := false
+	for _, name := range p.Operations {
+		if name == "*" || name == operation {
+			granted = true
+		}
+	}
+	if !granted {
+		return false
+	}
+	if len(p.Keys) == 0 {
+		return true
+	}
+	for _, pattern := range p.Keys {
+		if matched, _ := path.Match(pattern, key); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate identifies the caller of a request: the peer user of a unix
+// socket connection, the owner of the bearer token otherwise. The user
+// running the server and root hold every permission.
+func (s *APIServer) authenticate(r *http.Request) (*APICaller, error) {
+	tokens, err := loadAPITokens(s.Config.Tokenfile)
+	if err != nil {
+		return nil, err
+	}
+
+	if peer, found := r.Context().Value(peerKey{}).(apiPeer); found {
+		if peer.err != nil {
+			return nil, apiError{status: http.StatusUnauthorized, err: peer.err}
+		}
+		name := userName(peer.uid)
+		if peer.uid == 0 || peer.uid == os.Getuid() {
+			return &APICaller{Name: name, Permissions: allPermissions}, nil
+		}
+		return &APICaller{Name: name, Permissions: tokens.Users[name].Permissions}, nil
+	}
+
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || token == "" {
+		return nil, newAPIError(http.StatusUnauthorized, "a bearer token is required")
+	}
+	for name, principal := range tokens.Tokens {
+		if principal.Token != "" && subtle.ConstantTimeCompare([]byte(principal.Token), []byte(token)) == 1 {
+			return &APICaller{Name: name, Permissions: principal.Permissions}, nil
+		}
+	}
+	return nil, newAPIError(http.StatusUnauthorized, "invalid bearer token")
+}
+
+// userName returns the name of a user id, or the id when it has no name
+func userName(uid int) string {
+	if account, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		return account.Username
+	}
+	return strconv.Itoa(uid)
+}
+
+// authorize authenticates the caller and checks it may perform operation
+// on key. Refused requests are recorded in the audit log.
+func (s *APIServer) authorize(r *http.Request, operation, key string) (*APICaller, error) {
+	caller, err := s.authenticate(r)
+	if err != nil {
+		s.recordDenied(r, "", operation, key)
+		return nil, err
+	}
+	if !caller.Allowed(operation, key) {
+		s.recordDenied(r, caller.Name, operation, key)
+		return nil, newAPIError(http.StatusForbidden, "%s may not %s %s", caller.Name, operation, key)
+	}
+	return caller, nil
+}
+
+// authorizeAny is authorize for requests that are filtered by key, like
+// listing the configuration, which only need the operation on some key
+func (s *APIServer) authorizeAny(r *http.Request, operation string) (*APICaller, error) {
+	caller, err := s.authenticate(r)
+	if err != nil {
+		s.recordDenied(r, "", operation, "")
+		return nil, err
+	}
+	if !caller.AllowedAny(operation) {
+		s.recordDenied(r, caller.Name, operation, "")
+		return nil, newAPIError(http.StatusForbidden, "%s may not %s", caller.Name, operation)
+	}
+	return caller, nil
+}
+
+// authorizeRoles checks the caller may add every role and write every
+// template of the roles. It returns the refused operation and key, which
+// are recorded with recordDenied once the data lock is released.
+func (s *APIServer) authorizeRoles(caller *APICaller, roles []string) (string, string, error) {
+	for _, role := range roles {
+		if !caller.Allowed(OperationRole, role) {
+			return OperationRole, role, newAPIError(http.StatusForbidden, "%s may not %s %s", caller.Name, OperationRole, role)
+		}
+		files, err := roleFiles(s.Config, role)
+		if err != nil {
+			return "", "", err
+		}
+		for _, file := range files {
+			key := roleTemplateKey(s.Config, file)
+			if !caller.Allowed(OperationWriteTemplate, key) {
+				return OperationWriteTemplate, key, newAPIError(http.StatusForbidden, "%s may not %s %s", caller.Name, OperationWriteTemplate, key)
+			}
+		}
+	}
+	return "", "", nil
+}
+
+// recordDenied records a refused request in the audit log
+func (s *APIServer) recordDenied(r *http.Request, caller, operation, key string) {
+	if caller == "" {
+		caller = "unauthenticated"
+	}
+
+	d, err := data.New(*s.Config)
+	if err != nil {
+		log.Warnf("Failed to log denied request: %v", err)
+		return
+	}
+	unlock, err := d.Lock()
+	if err != nil {
+		log.Warnf("Failed to log denied request: %v", err)
+		return
+	}
+	defer unlock()
+
+	value := strings.TrimSpace(operation + " " + key)
+	if err := d.Log(DeniedOption, value, caller, fmt.Sprintf("%s %s", r.Method, r.URL.Path)); err != nil {
+		log.Warnf("Failed to log denied request: %v", err)
+	}
+}
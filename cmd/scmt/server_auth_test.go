@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/jvzantvoort/scmt/config"
+	"github.com/jvzantvoort/scmt/data"
+	"github.com/jvzantvoort/scmt/logger"
+)
+
+const testTokens = `{
+  "users": {
+    "nobody": {"permissions": [{"operations": ["read"]}]}
+  },
+  "tokens": {
+    "dashboard": {
+      "token": "s3cr3t",
+      "permissions": [
+        {"operations": ["read"], "keys": ["OWNER", "COMPUTE_*"]},
+        {"operations": ["set"], "keys": ["COMPUTE_*"]}
+      ]
+    }
+  }
+}`
+
+// tokenRequest sends a request to the API with a bearer token
+func tokenRequest(handler http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestAPIServer_Tokens(t *testing.T) {
+	tmpDir := setupTestEnvironment(t)
+	initializeTestData(t)
+	if err := os.WriteFile(filepath.Join(tmpDir, "tokens.json"), []byte(testTokens), 0600); err != nil {
+		t.Fatalf("Failed to write tokens: %v", err)
+	}
+	handler := (&APIServer{Config: config.New()}).Handler()
+
+	for _, token := range []string{"", "wrong"} {
+		if response := tokenRequest(handler, "GET", "/v1/elements", token, ""); response.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for token %q, got %d", token, response.Code)
+		}
+	}
+
+	// Listings only hold the options the token may read
+	response := tokenRequest(handler, "GET", "/v1/elements", "s3cr3t", "")
+	var values []data.EffectiveValue
+	if err := json.Unmarshal(response.Body.Bytes(), &values); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(values) != 3 {
+		t.Errorf("Expected OWNER, COMPUTE_REGION and COMPUTE_ZONE, got %+v", values)
+	}
+
+	if response := tokenRequest(handler, "GET", "/v1/elements/TIMEZONE", "s3cr3t", ""); response.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 reading TIMEZONE, got %d", response.Code)
+	}
+	if response := tokenRequest(handler, "PUT", "/v1/elements/OWNER", "s3cr3t", `{"value": "Ops", "message": "handover"}`); response.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 setting OWNER, got %d", response.Code)
+	}
+	if response := tokenRequest(handler, "POST", "/v1/roles", "s3cr3t", `{"role": "web-server", "message": "deploy"}`); response.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 adding a role, got %d", response.Code)
+	}
+
+	response = tokenRequest(handler, "PUT", "/v1/elements/COMPUTE_ZONE", "s3cr3t", `{"value": "europe-west4-b", "message": "move"}`)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+	}
+
+	// The token name is the engineer, denied attempts are audited
+	logh, err := logger.New(filepath.Join(tmpDir, "test.log"))
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	if records := logh.Select("COMPUTE_ZONE"); records[0].Engineer != "dashboard" {
+		t.Errorf("Expected dashboard as engineer, got %+v", records[0])
+	}
+	denied := logh.Select(DeniedOption)
+	if len(denied) != 5 {
+		t.Fatalf("Expected 5 denied requests in the audit log, got %+v", denied)
+	}
+	denials := map[string]string{}
+	for _, record := range denied {
+		denials[record.Value] = record.Engineer
+	}
+	if denials["set OWNER"] != "dashboard" || denials["role web-server"] != "dashboard" {
+		t.Errorf("Unexpected denied requests %+v", denied)
+	}
+}
+
+func TestAPIServer_PeerUser(t *testing.T) {
+	tmpDir := setupTestEnvironment(t)
+	initializeTestData(t)
+	if err := os.WriteFile(filepath.Join(tmpDir, "tokens.json"), []byte(testTokens), 0600); err != nil {
+		t.Fatalf("Failed to write tokens: %v", err)
+	}
+	handler := (&APIServer{Config: config.New()}).Handler()
+
+	// Unknown users hold no permissions, tokens do not apply to the socket
+	request := httptest.NewRequest("GET", "/v1/elements", nil)
+	request.Header.Set("Authorization", "Bearer s3cr3t")
+	request = request.WithContext(context.WithValue(request.Context(), peerKey{}, apiPeer{uid: 4242424}))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for an unknown user, got %d", recorder.Code)
+	}
+}
+
+func TestLoadAPITokens(t *testing.T) {
+	tokenfile := filepath.Join(t.TempDir(), "tokens.json")
+
+	tokens, err := loadAPITokens(tokenfile)
+	if err != nil || len(tokens.Tokens) != 0 {
+		t.Errorf("Expected no tokens without a file, got %+v, %v", tokens, err)
+	}
+
+	if err := os.WriteFile(tokenfile, []byte(testTokens), 0644); err != nil {
+		t.Fatalf("Failed to write tokens: %v", err)
+	}
+	if _, err := loadAPITokens(tokenfile); err == nil {
+		t.Error("Expected error for a tokens file readable by others")
+	}
+
+	if err := os.Chmod(tokenfile, 0640); err != nil {
+		t.Fatalf("Failed to chmod tokens: %v", err)
+	}
+	tokens, err = loadAPITokens(tokenfile)
+	if err != nil {
+		t.Fatalf("Failed to load tokens: %v", err)
+	}
+	if tokens.Tokens["dashboard"].Token != "s3cr3t" || len(tokens.Users["nobody"].Permissions) != 1 {
+		t.Errorf("Unexpected tokens %+v", tokens)
+	}
+}
+
+func TestAPICaller_Allowed(t *testing.T) {
+	caller := APICaller{Name: "dashboard", Permissions: []APIPermission{
+		{Operations: []string{OperationRead}},
+		{Operations: []string{OperationSet, OperationRole}, Keys: []string{"APP_*", "web-*"}},
+	}}
+
+	tests := []struct {
+		operation string
+		key       string
+		expected  bool
+	}{
+		{OperationRead, "OWNER", true},
+		{OperationSet, "APP_PORT", true},
+		{OperationSet, "OWNER", false},
+		{OperationRole, "web-server", true},
+		{OperationWriteTemplate, "app.conf", false},
+	}
+	for _, test := range tests {
+		if got := caller.Allowed(test.operation, test.key); got != test.expected {
+			t.Errorf("Allowed(%s, %s): expected %t, got %t", test.operation, test.key, test.expected, got)
+		}
+	}
+
+	if !caller.AllowedAny(OperationRole) || caller.AllowedAny(OperationWriteTemplate) {
+		t.Error("Unexpected AllowedAny result")
+	}
+}
+
+func TestAPIServer_PeerCredentials(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("SO_PEERCRED is only supported on Linux")
+	}
+	setupTestEnvironment(t)
+	initializeTestData(t)
+
+	socket := filepath.Join(t.TempDir(), "scmt.sock")
+	listener, err := apiListen("unix:" + socket)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := &http.Server{
+		Handler:     (&APIServer{Config: config.New()}).Handler(),
+		ConnContext: apiConnContext,
+	}
+	go func() { _ = server.Serve(listener) }()
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return net.Dial("unix", socket)
+		},
+	}}
+
+	// The user running the server holds every permission
+	response, err := client.Get("http://scmt/v1/elements/OWNER")
+	if err != nil {
+		t.Fatalf("Failed to query the server: %v", err)
+	}
+	defer response.Body.Close()
+	content, _ := io.ReadAll(response.Body)
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200, got %d: %s", response.StatusCode, content)
+	}
+}
+
+func TestAPIServer_RolePermissions(t *testing.T) {
+	tmpDir := setupTestEnvironment(t)
+	initializeTestData(t)
+	rootDir := setupRoleTemplates(t, tmpDir)
+	catalog := `{"roles": {"frontend": {"requires": ["web-server"]}, "web-server": {}, "database": {}}}`
+	if err := os.WriteFile(filepath.Join(tmpDir, "catalog.json"), []byte(catalog), 0644); err != nil {
+		t.Fatalf("Failed to write catalog: %v", err)
+	}
+	tokens := `{"tokens": {
+	  "deployer": {"token": "d3pl0y", "permissions": [
+	    {"operations": ["role", "read-role"], "keys": ["frontend"]}
+	  ]},
+	  "operator": {"token": "0p3r4t0r", "permissions": [
+	    {"operations": ["role", "read-role"], "keys": ["frontend", "web-server"]},
+	    {"operations": ["write-template"], "keys": ["web-server/etc/nginx/nginx.conf"]}
+	  ]},
+	  "reader": {"token": "r34d", "permissions": [{"operations": ["read"]}]}
+	}}`
+	if err := os.WriteFile(filepath.Join(tmpDir, "tokens.json"), []byte(tokens), 0600); err != nil {
+		t.Fatalf("Failed to write tokens: %v", err)
+	}
+	handler := (&APIServer{Config: config.New()}).Handler()
+	body := `{"role": "frontend", "message": "deploy"}`
+
+	// A required role needs the role permission as well
+	if response := tokenRequest(handler, "POST", "/v1/roles", "d3pl0y", body); response.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 adding the required role web-server, got %d", response.Code)
+	}
+	// Every template of the added roles needs write-template
+	if response := tokenRequest(handler, "POST", "/v1/roles", "0p3r4t0r", body); response.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 writing web-server/etc/nginx/site.conf, got %d", response.Code)
+	}
+
+	d, err := data.New(*config.New())
+	if err != nil {
+		t.Fatalf("Failed to create data: %v", err)
+	}
+	if err := d.Open(); err != nil {
+		t.Fatalf("Failed to open data: %v", err)
+	}
+	if len(d.Roles) != 0 {
+		t.Errorf("Expected no roles after denied requests, got %+v", d.Roles)
+	}
+	if _, err := os.Stat(filepath.Join(rootDir, "etc")); !os.IsNotExist(err) {
+		t.Error("Expected no templates rendered after denied requests")
+	}
+
+	logh, err := logger.New(filepath.Join(tmpDir, "test.log"))
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	denials := map[string]string{}
+	for _, record := range logh.Select(DeniedOption) {
+		denials[record.Value] = record.Engineer
+	}
+	if denials["role web-server"] != "deployer" || denials["write-template web-server/etc/nginx/site.conf"] != "operator" {
+		t.Errorf("Unexpected denied requests %+v", denials)
+	}
+
+	// Listings only hold the roles the caller may read
+	if response := apiRequest(t, handler, "POST", "/v1/roles", body); response.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", response.Code, response.Body.String())
+	}
+	var roles []data.Role
+	response := tokenRequest(handler, "GET", "/v1/roles", "d3pl0y", "")
+	if err := json.Unmarshal(response.Body.Bytes(), &roles); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(roles) != 1 || roles[0].Name != "frontend" {
+		t.Errorf("Expected only frontend, got %+v", roles)
+	}
+
+	// Reading options does not grant reading roles
+	if response := tokenRequest(handler, "GET", "/v1/roles", "r34d", ""); response.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 listing roles with read, got %d", response.Code)
+	}
+}
+
+func TestAPIServer_LogPermissions(t *testing.T) {
+	tmpDir := setupTestEnvironment(t)
+	initializeTestData(t)
+	tokens := fmt.Sprintf(`{"tokens": {"auditor": {"token": "4ud1t", "permissions": [
+	  {"operations": ["read"], "keys": ["OWNER", %q]}
+	]}}}`, data.OptionRemoveOption)
+	if err := os.WriteFile(filepath.Join(tmpDir, "tokens.json"), []byte(tokens), 0600); err != nil {
+		t.Fatalf("Failed to write tokens: %v", err)
+	}
+	handler := (&APIServer{Config: config.New()}).Handler()
+
+	for _, option := range []string{"OWNER", "TIMEZONE"} {
+		if response := apiRequest(t, handler, "DELETE", "/v1/elements/"+option, `{"message": "cleanup"}`); response.Code != http.StatusOK {
+			t.Fatalf("Expected 200 removing %s, got %d: %s", option, response.Code, response.Body.String())
+		}
+	}
+
+	// Removals of options the caller may not read are left out
+	for _, path := range []string{"/v1/log", "/v1/log?option=" + data.OptionRemoveOption} {
+		response := tokenRequest(handler, "GET", path, "4ud1t", "")
+		var records []logger.Record
+		if err := json.Unmarshal(response.Body.Bytes(), &records); err != nil {
+			t.Fatalf("Failed to parse response of %s: %v", path, err)
+		}
+		removals := []string{}
+		for _, record := range records {
+			if record.Option == data.OptionRemoveOption {
+				removals = append(removals, record.Value)
+			}
+		}
+		if len(removals) != 1 || removals[0] != "OWNER=Mad House" {
+			t.Errorf("Expected only the removal of OWNER from %s, got %v", path, removals)
+		}
+	}
+}
+
+func TestAPIServer_RenderPermissions(t *testing.T) {
+	tmpDir := setupTestEnvironment(t)
+	initializeTestData(t)
+	t.Setenv("SCMT_TEST_SECRET", "s3cr3t-value")
+
+	writeTemplateFiles(t, filepath.Join(tmpDir, "templates"), map[string]string{
+		"config.tmpl": `owner={{.Config.OWNER}} type={{index .Config "TYPE"}}`,
+		"env.tmpl":    `secret={{env "SCMT_TEST_SECRET"}}`,
+	})
+	tokens := `{"tokens": {"renderer": {"token": "r3nd3r", "permissions": [
+	  {"operations": ["write-template"]},
+	  {"operations": ["read"], "keys": ["OWNER"]}
+	]}}}`
+	if err := os.WriteFile(filepath.Join(tmpDir, "tokens.json"), []byte(tokens), 0600); err != nil {
+		t.Fatalf("Failed to write tokens: %v", err)
+	}
+	handler := (&APIServer{Config: config.New()}).Handler()
+
+	// Keys the caller may not read are left out
+	response := tokenRequest(handler, "POST", "/v1/render", "r3nd3r", `{"template": "config.tmpl"}`)
+	if response.Code != http.StatusOK || response.Body.String() != "owner=Mad House type=" {
+		t.Errorf("Expected only OWNER rendered, got %d: %q", response.Code, response.Body.String())
+	}
+
+	// The environment of the server is not available
+	response = tokenRequest(handler, "POST", "/v1/render", "r3nd3r", `{"template": "env.tmpl"}`)
+	if response.Code != http.StatusUnprocessableEntity || strings.Contains(response.Body.String(), "s3cr3t-value") {
+		t.Errorf("Expected 422 without the secret, got %d: %q", response.Code, response.Body.String())
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jvzantvoort/scmt/config"
+	"github.com/jvzantvoort/scmt/data"
+	"github.com/jvzantvoort/scmt/logger"
+	"github.com/jvzantvoort/scmt/state"
+)
+
+// apiRequest sends a request to the API as the user running the tests, who
+// holds every permission, and returns the response
+func apiRequest(t *testing.T, handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request = request.WithContext(context.WithValue(request.Context(), peerKey{}, apiPeer{uid: os.Getuid()}))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestAPIServer_Elements(t *testing.T) {
+	setupTestEnvironment(t)
+	initializeTestData(t)
+	handler := (&APIServer{Config: config.New()}).Handler()
+
+	response := apiRequest(t, handler, "GET", "/v1/elements/OWNER", "")
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+	}
+	var value data.EffectiveValue
+	if err := json.Unmarshal(response.Body.Bytes(), &value); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if value.Value != "Mad House" || value.Source != data.SourceExplicit {
+		t.Errorf("Unexpected value %+v", value)
+	}
+
+	if response := apiRequest(t, handler, "GET", "/v1/elements/MISSING", ""); response.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing option, got %d", response.Code)
+	}
+
+	// Changes require a message
+	response = apiRequest(t, handler, "PUT", "/v1/elements/OWNER", `{"value": "Ops"}`)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a message, got %d", response.Code)
+	}
+
+	response = apiRequest(t, handler, "PUT", "/v1/elements/OWNER", `{"value": "Ops", "message": "handover"}`)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+	}
+
+	d, _ := data.New(*config.New())
+	if err := d.Open(); err != nil {
+		t.Fatalf("Failed to open data: %v", err)
+	}
+	// The caller is recorded as engineer
+	owner, _ := d.Get("OWNER")
+	if owner.Value != "Ops" || owner.Engineer != userName(os.Getuid()) || owner.Message != "handover" {
+		t.Errorf("Expected the change to be saved, got %+v", owner)
+	}
+
+	response = apiRequest(t, handler, "DELETE", "/v1/elements/OWNER", `{"message": "cleanup"}`)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+	}
+	if response := apiRequest(t, handler, "DELETE", "/v1/elements/OWNER", `{"message": "cleanup"}`); response.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a removed option, got %d", response.Code)
+	}
+
+	// The audit log holds the changes, newest first, and the removal
+	response = apiRequest(t, handler, "GET", "/v1/log?option=OWNER", "")
+	var records []map[string]interface{}
+	if err := json.Unmarshal(response.Body.Bytes(), &records); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(records) != 2 || records[0]["message"] != "handover" {
+		t.Errorf("Unexpected log records %v", records)
+	}
+	response = apiRequest(t, handler, "GET", "/v1/log?option="+data.OptionRemoveOption, "")
+	records = nil
+	if err := json.Unmarshal(response.Body.Bytes(), &records); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(records) != 1 || records[0]["value"] != "OWNER=Ops" || records[0]["message"] != "cleanup" {
+		t.Errorf("Unexpected removal records %v", records)
+	}
+}
+
+func TestAPIServer_Roles(t *testing.T) {
+	setupTestEnvironment(t)
+	initializeTestData(t)
+	handler := (&APIServer{Config: config.New()}).Handler()
+
+	response := apiRequest(t, handler, "POST", "/v1/roles", `{"role": "web-server", "parameters": {"port": "8080"}, "message": "deploy"}`)
+	if response.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", response.Code, response.Body.String())
+	}
+	response = apiRequest(t, handler, "POST", "/v1/roles", `{"role": "web-server", "message": "deploy"}`)
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected 200 for an assigned role, got %d", response.Code)
+	}
+
+	response = apiRequest(t, handler, "GET", "/v1/roles", "")
+	var roles []data.Role
+	if err := json.Unmarshal(response.Body.Bytes(), &roles); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(roles) != 1 || roles[0].Name != "web-server" || roles[0].Parameters["port"] != "8080" {
+		t.Errorf("Unexpected roles %+v", roles)
+	}
+
+	response = apiRequest(t, handler, "DELETE", "/v1/roles/web-server", `{"message": "retire"}`)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+	}
+	if response := apiRequest(t, handler, "DELETE", "/v1/roles/web-server", `{"message": "retire"}`); response.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a removed role, got %d", response.Code)
+	}
+}
+
+func TestAPIServer_RoleTemplates(t *testing.T) {
+	tmpDir := setupTestEnvironment(t)
+	initializeTestData(t)
+	rootDir := setupRoleTemplates(t, tmpDir)
+	handler := (&APIServer{Config: config.New()}).Handler()
+
+	response := apiRequest(t, handler, "POST", "/v1/roles", `{"role": "web-server", "message": "deploy"}`)
+	if response.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", response.Code, response.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(rootDir, "etc", "nginx", "nginx.conf")); err != nil {
+		t.Fatalf("Expected the role template to be rendered: %v", err)
+	}
+
+	// The caller rendered the files, not the user running the server
+	caller := userName(os.Getuid())
+	st, err := state.New(filepath.Join(tmpDir, "state.json"))
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	for _, entry := range st.Entries {
+		if entry.Engineer != caller {
+			t.Errorf("Expected %s as engineer of %s, got %s", caller, entry.Path, entry.Engineer)
+		}
+	}
+	logh, err := logger.New(filepath.Join(tmpDir, "test.log"))
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	records := logh.Select("TEMPLATE_WRITE")
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 template writes, got %+v", records)
+	}
+	for _, record := range records {
+		if record.Engineer != caller {
+			t.Errorf("Expected %s as engineer, got %+v", caller, record)
+		}
+	}
+}
+
+func TestAPIServer_Render(t *testing.T) {
+	tmpDir := setupTestEnvironment(t)
+	initializeTestData(t)
+
+	templateDir := filepath.Join(tmpDir, "templates")
+	if err := os.MkdirAll(templateDir, 0755); err != nil {
+		t.Fatalf("Failed to create template dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(templateDir, "owner.tmpl"), []byte("owner={{.Config.OWNER}}\n"), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	handler := (&APIServer{Config: config.New()}).Handler()
+
+	response := apiRequest(t, handler, "POST", "/v1/render", `{"template": "owner.tmpl"}`)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body.String())
+	}
+	if response.Body.String() != "owner=Mad House\n" {
+		t.Errorf("Unexpected output %q", response.Body.String())
+	}
+
+	// Only templates of the library are rendered
+	for _, name := range []string{filepath.Join(tmpDir, "data.json"), "../data.json", "missing.tmpl"} {
+		body, _ := json.Marshal(APIRender{Template: name})
+		if response := apiRequest(t, handler, "POST", "/v1/render", string(body)); response.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for %s, got %d", name, response.Code)
+		}
+	}
+}
+
+func TestAPIListen(t *testing.T) {
+	for _, address := range []string{"0.0.0.0:8080", "192.0.2.1:8080", "8080"} {
+		if listener, err := apiListen(address); err == nil {
+			listener.Close()
+			t.Errorf("Expected %s to be refused", address)
+		}
+	}
+
+	socket := filepath.Join(t.TempDir(), "scmt.sock")
+	listener, err := apiListen("unix:" + socket)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	if info, err := os.Stat(socket); err != nil || info.Mode().Perm() != 0660 {
+		t.Errorf("Expected a socket with mode 0660, got %v, %v", info, err)
+	}
+
+	// A socket in use is not taken over
+	if second, err := apiListen("unix:" + socket); err == nil {
+		second.Close()
+		t.Error("Expected a socket in use to be refused")
+	}
+	listener.Close()
+}
+
+func TestAPIServer_HookVeto(t *testing.T) {
+	tmpDir := setupTestEnvironment(t)
+	initializeTestData(t)
+
+	hooksdir := filepath.Join(tmpDir, "hooks.d")
+	if err := os.MkdirAll(hooksdir, 0755); err != nil {
+		t.Fatalf("Failed to create hooks dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(hooksdir, "pre-10-freeze"), []byte("#!/bin/sh\necho frozen\nexit 1\n"), 0755); err != nil {
+		t.Fatalf("Failed to write hook: %v", err)
+	}
+	handler := (&APIServer{Config: config.New()}).Handler()
+
+	response := apiRequest(t, handler, "PUT", "/v1/elements/OWNER", `{"value": "Ops", "message": "handover"}`)
+	if response.Code != http.StatusConflict || !strings.Contains(response.Body.String(), "frozen") {
+		t.Errorf("Expected 409 for a vetoed change, got %d: %s", response.Code, response.Body.String())
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// templateFuncs returns the function map available to templates rendered
+// with the given data. The include function is bound to its template set by
+// loadTemplate, the stub here only makes it known to the parser.
+func templateFuncs(data *TemplateData) template.FuncMap {
+	return template.FuncMap{
+		// strings
+		"join":         strings.Join,
+		"upper":        strings.ToUpper,
+		"lower":        strings.ToLower,
+		"hasPrefix":    strings.HasPrefix,
+		"hasSuffix":    strings.HasSuffix,
+		"replace":      strings.Replace,
+		"split":        strings.Split,
+		"trim":         strings.TrimSpace,
+		"contains":     funcContains,
+		"quote":        funcQuote,
+		"indent":       funcIndent,
+		"nindent":      funcNindent,
+		"regexMatch":   funcRegexMatch,
+		"regexReplace": funcRegexReplace,
+		"include":      funcInclude,
+
+		// defaults
+		"default":  funcDefault,
+		"coalesce": funcCoalesce,
+		"required": data.Required,
+
+		// encoding
+		"toJson": funcToJSON,
+		"toYaml": funcToYAML,
+		"b64enc": funcB64Enc,
+		"b64dec": funcB64Dec,
+		"sha256": funcSha256,
+
+		// arithmetic and lists
+		"add": funcAdd,
+		"sub": funcSub,
+		"mul": funcMul,
+		"div": funcDiv,
+		"mod": funcMod,
+		"seq": funcSeq,
+
+		// environment
+		"env": os.Getenv,
+		"now": data.Now,
+	}
+}
+
+// isEmpty reports whether value is nil or the zero value of its type, an
+// empty string, slice or map
+func isEmpty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	}
+	return rv.IsZero()
+}
+
+// funcInclude is replaced by loadTemplate with a function rendering the named
+// template of the set being executed
+func funcInclude(name string, value interface{}) (string, error) {
+	return "", fmt.Errorf("include %q: no template set", name)
+}
+
+// funcNoEnv replaces env in renders on behalf of API callers, who may not
+// read the environment of the server
+func funcNoEnv(name string) (string, error) {
+	return "", fmt.Errorf("env %q: the environment of the server is not available", name)
+}
+
+// funcDefault returns value, or fallback when value is empty
+//
+//	{{.Config.PORT | default "8080"}}
+func funcDefault(fallback, value interface{}) interface{} {
+	if isEmpty(value) {
+		return fallback
+	}
+	return value
+}
+
+// funcCoalesce returns the first non-empty value
+func funcCoalesce(values ...interface{}) interface{} {
+	for _, value := range values {
+		if !isEmpty(value) {
+			return value
+		}
+	}
+	return nil
+}
+
+// funcContains reports whether substr is within s
+func funcContains(substr, s string) bool {
+	return strings.Contains(s, substr)
+}
+
+// funcQuote returns s as a double quoted string with Go escaping
+func funcQuote(s string) string {
+	return strconv.Quote(s)
+}
+
+// funcIndent prefixes every line in s with width spaces
+func funcIndent(width int, s string) string {
+	pad := strings.Repeat(" ", width)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+// funcNindent is funcIndent preceded by a newline
+func funcNindent(width int, s string) string {
+	return "\n" + funcIndent(width, s)
+}
+
+// funcRegexMatch reports whether s matches the regular expression
+func funcRegexMatch(regex, s string) (bool, error) {
+	return regexp.MatchString(regex, s)
+}
+
+// funcRegexReplace replaces all matches of the regular expression in s with
+// repl, which may contain $1 style references to submatches
+//
+//	{{.Config.HOSTNAME | regexReplace "\\..*$" ""}}
+func funcRegexReplace(regex, repl, s string) (string, error) {
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		return "", err
+	}
+	return re.ReplaceAllString(s, repl), nil
+}
+
+// funcToJSON encodes value as compact JSON
+func funcToJSON(value interface{}) (string, error) {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// funcToYAML encodes value as YAML without a trailing newline
+func funcToYAML(value interface{}) (string, error) {
+	content, err := yaml.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(content), "\n"), nil
+}
+
+// funcB64Enc encodes s as standard base64
+func funcB64Enc(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// funcB64Dec decodes standard base64 encoded s
+func funcB64Dec(s string) (string, error) {
+	content, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// funcSha256 returns the hex encoded SHA-256 digest of s
+func funcSha256(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// toInt converts numbers and numeric strings, the type of every
+// configuration value, to an int
+func toInt(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case int32:
+		return int(v), nil
+	case float64:
+		return int(v), nil
+	case string:
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", v)
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("cannot convert %v (%T) to a number", value, value)
+}
+
+// toInts converts a pair of operands with toInt
+func toInts(a, b interface{}) (int, int, error) {
+	x, err := toInt(a)
+	if err != nil {
+		return 0, 0, err
+	}
+	y, err := toInt(b)
+	if err != nil {
+		return 0, 0, err
+	}
+	return x, y, nil
+}
+
+func funcAdd(a, b interface{}) (int, error) {
+	x, y, err := toInts(a, b)
+	return x + y, err
+}
+
+func funcSub(a, b interface{}) (int, error) {
+	x, y, err := toInts(a, b)
+	return x - y, err
+}
+
+func funcMul(a, b interface{}) (int, error) {
+	x, y, err := toInts(a, b)
+	return x * y, err
+}
+
+func funcDiv(a, b interface{}) (int, error) {
+	x, y, err := toInts(a, b)
+	if err != nil {
+		return 0, err
+	}
+	if y == 0 {
+		return 0, fmt.Errorf("division by zero")
+	}
+	return x / y, nil
+}
+
+func funcMod(a, b interface{}) (int, error) {
+	x, y, err := toInts(a, b)
+	if err != nil {
+		return 0, err
+	}
+	if y == 0 {
+		return 0, fmt.Errorf("division by zero")
+	}
+	return x % y, nil
+}
+
+// funcSeq returns a list of integers following the seq(1) conventions:
+// "seq LAST", "seq FIRST LAST" and "seq FIRST INCREMENT LAST"
+func funcSeq(args ...interface{}) ([]int, error) {
+	nums := make([]int, len(args))
+	for i, arg := range args {
+		n, err := toInt(arg)
+		if err != nil {
+			return nil, err
+		}
+		nums[i] = n
+	}
+
+	first, step, last := 1, 1, 0
+	switch len(nums) {
+	case 1:
+		last = nums[0]
+	case 2:
+		first, last = nums[0], nums[1]
+	case 3:
+		first, step, last = nums[0], nums[1], nums[2]
+	default:
+		return nil, fmt.Errorf("seq expects 1 to 3 arguments, got %d", len(nums))
+	}
+	if step == 0 {
+		return nil, fmt.Errorf("seq increment cannot be zero")
+	}
+
+	retv := []int{}
+	for i := first; (step > 0 && i <= last) || (step < 0 && i >= last); i += step {
+		retv = append(retv, i)
+	}
+	return retv, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+// renderString renders a template string with the standard function map
+func renderString(t *testing.T, content string, td *TemplateData) (string, error) {
+	t.Helper()
+	tmpl, err := template.New("test").Funcs(templateFuncs(td)).Parse(content)
+	if err != nil {
+		t.Fatalf("Failed to parse template %q: %v", content, err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, td)
+	return buf.String(), err
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	td := &TemplateData{
+		Config: map[string]string{
+			"OWNER":    "Mad House",
+			"PORT":     "8080",
+			"EMPTY":    "",
+			"HOSTNAME": "web01.example.com",
+			"SECRET":   "c2VjcmV0",
+		},
+		Roles: []string{"web-server", "database"},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"upper", `{{upper .Config.OWNER}}`, "MAD HOUSE"},
+		{"default empty", `{{.Config.EMPTY | default "fallback"}}`, "fallback"},
+		{"default missing", `{{.Config.MISSING | default "fallback"}}`, "fallback"},
+		{"default set", `{{.Config.PORT | default "80"}}`, "8080"},
+		{"coalesce", `{{coalesce .Config.EMPTY .Config.MISSING .Config.OWNER}}`, "Mad House"},
+		{"toJson map", `{{toJson .Roles}}`, `["web-server","database"]`},
+		{"toJson string", `{{toJson .Config.OWNER}}`, `"Mad House"`},
+		{"toYaml", `{{toYaml .Roles}}`, "- web-server\n- database"},
+		{"indent", `{{indent 2 "a\nb"}}`, "  a\n  b"},
+		{"nindent", `x:{{toYaml .Roles | nindent 2}}`, "x:\n  - web-server\n  - database"},
+		{"quote", `{{quote .Config.OWNER}}`, `"Mad House"`},
+		{"quote escapes", `{{quote "say \"hi\""}}`, `"say \"hi\""`},
+		{"b64enc", `{{b64enc "secret"}}`, "c2VjcmV0"},
+		{"b64dec", `{{b64dec .Config.SECRET}}`, "secret"},
+		{"sha256", `{{sha256 "abc"}}`, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"contains true", `{{contains "example" .Config.HOSTNAME}}`, "true"},
+		{"contains false", `{{.Config.HOSTNAME | contains "nope"}}`, "false"},
+		{"regexMatch", `{{regexMatch "^web[0-9]+\\." .Config.HOSTNAME}}`, "true"},
+		{"regexReplace", `{{.Config.HOSTNAME | regexReplace "\\..*$" ""}}`, "web01"},
+		{"regexReplace groups", `{{regexReplace "^(\\w+)\\.(\\w+).*" "$2-$1" .Config.HOSTNAME}}`, "example-web01"},
+		{"seq last", `{{range seq 3}}{{.}}{{end}}`, "123"},
+		{"seq first last", `{{range seq 2 4}}{{.}}{{end}}`, "234"},
+		{"seq increment", `{{range seq 10 -5 0}}{{.}} {{end}}`, "10 5 0 "},
+		{"add", `{{add .Config.PORT 1}}`, "8081"},
+		{"sub", `{{sub .Config.PORT 80}}`, "8000"},
+		{"mul", `{{mul 6 7}}`, "42"},
+		{"div", `{{div .Config.PORT 2}}`, "4040"},
+		{"mod", `{{mod 7 3}}`, "1"},
+		{"nested arithmetic", `{{add (mul 2 3) (len .Roles)}}`, "8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := renderString(t, tt.template, td)
+			if err != nil {
+				t.Fatalf("Failed to render %q: %v", tt.template, err)
+			}
+			if output != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestTemplateFuncs_Errors(t *testing.T) {
+	td := &TemplateData{
+		Config: map[string]string{"PORT": "http"},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		contains string
+	}{
+		{"div by zero", `{{div 1 0}}`, "division by zero"},
+		{"mod by zero", `{{mod 1 0}}`, "division by zero"},
+		{"not a number", `{{add .Config.PORT 1}}`, `"http" is not a number`},
+		{"bad base64", `{{b64dec "!!"}}`, "illegal base64"},
+		{"bad regex", `{{regexMatch "(" "x"}}`, "missing closing )"},
+		{"seq zero step", `{{seq 1 0 5}}`, "increment cannot be zero"},
+		{"seq arguments", `{{seq}}`, "seq expects 1 to 3 arguments"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := renderString(t, tt.template, td)
+			if err == nil {
+				t.Fatalf("Expected error rendering %q", tt.template)
+			}
+			if !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("Expected error containing %q, got: %v", tt.contains, err)
+			}
+		})
+	}
+}
+
+func TestTemplateFuncs_Env(t *testing.T) {
+	t.Setenv("SCMT_TEST_ENV", "from-env")
+
+	output, err := renderString(t, `{{env "SCMT_TEST_ENV"}}`, &TemplateData{})
+	if err != nil {
+		t.Fatalf("Failed to render env: %v", err)
+	}
+	if output != "from-env" {
+		t.Errorf("Expected 'from-env', got %q", output)
+	}
+
+	if err := os.Unsetenv("SCMT_TEST_ENV"); err != nil {
+		t.Fatalf("Failed to unset env: %v", err)
+	}
+	output, err = renderString(t, `{{env "SCMT_TEST_ENV" | default "unset"}}`, &TemplateData{})
+	if err != nil {
+		t.Fatalf("Failed to render env default: %v", err)
+	}
+	if output != "unset" {
+		t.Errorf("Expected 'unset', got %q", output)
+	}
+}
+
+func TestTemplateFuncs_Now(t *testing.T) {
+	output, err := renderString(t, `{{now "2006"}}`, &TemplateData{})
+	if err != nil {
+		t.Fatalf("Failed to render now: %v", err)
+	}
+	if output != time.Now().Format("2006") {
+		t.Errorf("Expected current year, got %q", output)
+	}
+
+	output, err = renderString(t, `{{now}}`, &TemplateData{})
+	if err != nil {
+		t.Fatalf("Failed to render now: %v", err)
+	}
+	if _, err := time.Parse("2006-01-02 15:04:05", output); err != nil {
+		t.Errorf("Expected default timestamp layout, got %q", output)
+	}
+}
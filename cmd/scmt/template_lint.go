@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/template"
+	"text/template/parse"
+)
+
+// LintResult describes the configuration keys and roles a template refers to
+type LintResult struct {
+	File     string   `json:"file"`
+	Keys     []string `json:"keys"`
+	Roles    []string `json:"roles"`
+	Warnings []string `json:"warnings"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// templateRefs collects the references found while walking a parse tree
+type templateRefs struct {
+	keys      map[string]bool
+	roles     map[string]bool
+	templates map[string]bool
+}
+
+// lintTemplate parses templateFile with the full function map and returns
+// the configuration keys and roles it references, including those of the
+// library templates it includes. Keys missing from known are reported as
+// warnings, a nil known skips that check.
+func lintTemplate(templateFile string, known map[string]string, opts TemplateOptions) LintResult {
+	retv := LintResult{
+		File:     templateFile,
+		Keys:     []string{},
+		Roles:    []string{},
+		Warnings: []string{},
+	}
+
+	content, err := os.ReadFile(templateFile)
+	if err != nil {
+		retv.Error = fmt.Sprintf("failed to read template file %s: %v", templateFile, err)
+		return retv
+	}
+
+	tmpl, err := template.New(filepath.Base(templateFile)).Funcs(templateFuncs(&TemplateData{})).Parse(string(content))
+	if err != nil {
+		retv.Error = fmt.Sprintf("failed to parse template %s: %v", templateFile, err)
+		return retv
+	}
+
+	refs := &templateRefs{keys: map[string]bool{}, roles: map[string]bool{}, templates: map[string]bool{}}
+	walked := map[string]bool{}
+	for _, t := range tmpl.Templates() {
+		walked[t.Name()] = true
+		if t.Tree != nil {
+			refs.walk(t.Tree.Root)
+		}
+	}
+	if err := refs.resolve(templateFile, walked, opts); err != nil {
+		retv.Error = err.Error()
+		return retv
+	}
+
+	for key := range refs.keys {
+		retv.Keys = append(retv.Keys, key)
+	}
+	for role := range refs.roles {
+		retv.Roles = append(retv.Roles, role)
+	}
+	sort.Strings(retv.Keys)
+	sort.Strings(retv.Roles)
+
+	if known != nil {
+		for _, key := range retv.Keys {
+			if _, ok := known[key]; !ok {
+				retv.Warnings = append(retv.Warnings, fmt.Sprintf("configuration key %q is not set", key))
+			}
+		}
+	}
+	return retv
+}
+
+// resolve walks the referenced templates the file does not define in the
+// library set loadTemplate builds. A reference to a missing or broken
+// library template is an error, as it fails the render.
+func (refs *templateRefs) resolve(templateFile string, walked map[string]bool, opts TemplateOptions) error {
+	var set *template.Template
+	var broken map[string]error
+	for {
+		pending := []string{}
+		for name := range refs.templates {
+			if !walked[name] {
+				pending = append(pending, name)
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		sort.Strings(pending)
+
+		if set == nil {
+			var err error
+			if set, broken, err = parseTemplateSet(templateFile, &TemplateData{}, opts); err != nil {
+				return err
+			}
+		}
+		for _, name := range pending {
+			walked[name] = true
+			if err, found := broken[name]; found {
+				return err
+			}
+			t := set.Lookup(name)
+			if t == nil || t.Tree == nil {
+				return fmt.Errorf("template %q is not defined", name)
+			}
+			refs.walk(t.Tree.Root)
+		}
+	}
+}
+
+// configKey returns the key of a .Config.KEY or $.Config.KEY reference
+func configKey(node parse.Node) (string, bool) {
+	var ident []string
+	switch n := node.(type) {
+	case *parse.FieldNode:
+		ident = n.Ident
+	case *parse.VariableNode:
+		if len(n.Ident) > 0 && n.Ident[0] == "$" {
+			ident = n.Ident[1:]
+		}
+	}
+	if len(ident) >= 2 && ident[0] == "Config" {
+		return ident[1], true
+	}
+	return "", false
+}
+
+// isConfig reports whether node refers to .Config itself
+func isConfig(node parse.Node) bool {
+	switch n := node.(type) {
+	case *parse.FieldNode:
+		return len(n.Ident) == 1 && n.Ident[0] == "Config"
+	case *parse.VariableNode:
+		return len(n.Ident) == 2 && n.Ident[0] == "$" && n.Ident[1] == "Config"
+	}
+	return false
+}
+
+// isRoleMethod reports whether node is a .HasRole or .RoleParam method
+// reference, both taking the role name as first argument
+func isRoleMethod(node parse.Node) bool {
+	var ident []string
+	switch n := node.(type) {
+	case *parse.FieldNode:
+		ident = n.Ident
+	case *parse.VariableNode:
+		ident = n.Ident
+	}
+	if len(ident) == 0 {
+		return false
+	}
+	method := ident[len(ident)-1]
+	return method == "HasRole" || method == "RoleParam"
+}
+
+// stringArg returns the value of args[i] when it is a string constant
+func stringArg(args []parse.Node, i int) (string, bool) {
+	if i >= len(args) {
+		return "", false
+	}
+	if s, ok := args[i].(*parse.StringNode); ok {
+		return s.Text, true
+	}
+	return "", false
+}
+
+func (refs *templateRefs) walk(node parse.Node) {
+	switch n := node.(type) {
+	case nil:
+		return
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			refs.walk(child)
+		}
+	case *parse.ActionNode:
+		refs.walk(n.Pipe)
+	case *parse.IfNode:
+		refs.walkBranch(&n.BranchNode)
+	case *parse.RangeNode:
+		refs.walkBranch(&n.BranchNode)
+	case *parse.WithNode:
+		refs.walkBranch(&n.BranchNode)
+	case *parse.TemplateNode:
+		refs.templates[n.Name] = true
+		refs.walk(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			refs.walk(cmd)
+		}
+	case *parse.ChainNode:
+		refs.walk(n.Node)
+	case *parse.CommandNode:
+		refs.walkCommand(n)
+	default:
+		if key, ok := configKey(node); ok {
+			refs.keys[key] = true
+		}
+	}
+}
+
+func (refs *templateRefs) walkBranch(n *parse.BranchNode) {
+	refs.walk(n.Pipe)
+	refs.walk(n.List)
+	refs.walk(n.ElseList)
+}
+
+func (refs *templateRefs) walkCommand(n *parse.CommandNode) {
+	if len(n.Args) > 0 {
+		switch first := n.Args[0].(type) {
+		case *parse.IdentifierNode:
+			switch first.Ident {
+			case "include":
+				if name, ok := stringArg(n.Args, 1); ok {
+					refs.templates[name] = true
+				}
+			case "required":
+				if key, ok := stringArg(n.Args, 1); ok {
+					refs.keys[key] = true
+				}
+			case "index":
+				if len(n.Args) > 1 && isConfig(n.Args[1]) {
+					if key, ok := stringArg(n.Args, 2); ok {
+						refs.keys[key] = true
+					}
+				}
+			}
+		default:
+			if isRoleMethod(first) {
+				if role, ok := stringArg(n.Args, 1); ok {
+					refs.roles[role] = true
+				}
+			}
+		}
+	}
+	for _, arg := range n.Args {
+		refs.walk(arg)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLintTemplate(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTemplateFiles(t, tmpDir, map[string]string{
+		"server.conf": `type = {{.Config.TYPE}}
+owner = {{$.Config.OWNER | upper}}
+{{if .HasRole "web-server"}}port = {{required "HTTP_PORT"}}{{end}}
+{{range .Roles}}{{if $.HasRole "database"}}db = {{index $.Config "DB_HOST"}}{{end}}{{end}}
+{{define "footer"}}zone = {{.Config.COMPUTE_ZONE}}{{end}}
+{{with .Config.TYPO}}{{.}}{{end}}
+listen = {{.RoleParam "proxy" "port"}}`,
+	})
+
+	known := map[string]string{
+		"TYPE":         "server",
+		"OWNER":        "Mad House",
+		"COMPUTE_ZONE": "europe-west4-a",
+	}
+
+	result := lintTemplate(filepath.Join(tmpDir, "server.conf"), known, TemplateOptions{})
+	if result.Error != "" {
+		t.Fatalf("Unexpected lint error: %s", result.Error)
+	}
+
+	expectedKeys := []string{"COMPUTE_ZONE", "DB_HOST", "HTTP_PORT", "OWNER", "TYPE", "TYPO"}
+	if !reflect.DeepEqual(result.Keys, expectedKeys) {
+		t.Errorf("Expected keys %v, got %v", expectedKeys, result.Keys)
+	}
+
+	expectedRoles := []string{"database", "proxy", "web-server"}
+	if !reflect.DeepEqual(result.Roles, expectedRoles) {
+		t.Errorf("Expected roles %v, got %v", expectedRoles, result.Roles)
+	}
+
+	if len(result.Warnings) != 3 {
+		t.Fatalf("Expected 3 warnings, got %v", result.Warnings)
+	}
+	for i, key := range []string{"DB_HOST", "HTTP_PORT", "TYPO"} {
+		if !strings.Contains(result.Warnings[i], key) {
+			t.Errorf("Expected warning about %s, got %q", key, result.Warnings[i])
+		}
+	}
+
+	// Without known keys only the references are reported
+	result = lintTemplate(filepath.Join(tmpDir, "server.conf"), nil, TemplateOptions{})
+	if len(result.Warnings) != 0 {
+		t.Errorf("Expected no warnings without known keys, got %v", result.Warnings)
+	}
+}
+
+func TestLintTemplate_ParseError(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTemplateFiles(t, tmpDir, map[string]string{
+		"invalid.conf": `{{.Config.TYPE`,
+		"unknown.conf": `{{nosuchfunc .Config.TYPE}}`,
+	})
+
+	for _, name := range []string{"invalid.conf", "unknown.conf"} {
+		result := lintTemplate(filepath.Join(tmpDir, name), nil, TemplateOptions{})
+		if !strings.Contains(result.Error, "failed to parse template") {
+			t.Errorf("Expected parse error for %s, got %q", name, result.Error)
+		}
+	}
+}
+
+func TestLintTemplate_Library(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTemplateFiles(t, tmpDir, map[string]string{
+		"site.conf":            `{{include "partials/header.conf" .}}{{template "footer" .}}`,
+		"partials/header.conf": `owner = {{.Config.OWNER}}{{template "partials/zone.conf" .}}`,
+		"partials/zone.conf":   `zone = {{.Config.COMPUTE_ZONE}}`,
+		"partials/footer.conf": `{{define "footer"}}{{if .HasRole "web-server"}}{{end}}{{end}}`,
+		"partials/broken.conf": `{{.Config.TYPE`,
+		"uses-broken.conf":     `{{include "partials/broken.conf" .}}`,
+		"uses-missing.conf":    `{{template "partials/missing.conf" .}}`,
+	})
+	opts := TemplateOptions{SearchPath: []string{tmpDir}}
+
+	// The references of included library templates are reported too
+	result := lintTemplate(filepath.Join(tmpDir, "site.conf"), nil, opts)
+	if result.Error != "" {
+		t.Fatalf("Unexpected lint error: %s", result.Error)
+	}
+	if expected := []string{"COMPUTE_ZONE", "OWNER"}; !reflect.DeepEqual(result.Keys, expected) {
+		t.Errorf("Expected keys %v, got %v", expected, result.Keys)
+	}
+	if expected := []string{"web-server"}; !reflect.DeepEqual(result.Roles, expected) {
+		t.Errorf("Expected roles %v, got %v", expected, result.Roles)
+	}
+
+	// Broken or missing library templates fail the render, so they fail lint
+	if result := lintTemplate(filepath.Join(tmpDir, "uses-broken.conf"), nil, opts); !strings.Contains(result.Error, "partials/broken.conf") {
+		t.Errorf("Expected an error for the broken include, got %q", result.Error)
+	}
+	if result := lintTemplate(filepath.Join(tmpDir, "uses-missing.conf"), nil, opts); !strings.Contains(result.Error, "is not defined") {
+		t.Errorf("Expected an error for the missing template, got %q", result.Error)
+	}
+}
+
+func TestTemplateLintCommand_Integration(t *testing.T) {
+	tmpDir := setupTestEnvironment(t)
+	initializeTestData(t)
+
+	writeTemplateFiles(t, filepath.Join(tmpDir, "templates"), map[string]string{
+		"good.conf": `{{.Config.TYPE}}`,
+		"typo.conf": `{{.Config.TYPO}}`,
+		"bad.conf":  `{{.Config.TYPE`,
+	})
+
+	if err := templateLintCmd.RunE(templateLintCmd, []string{"good.conf", "typo.conf"}); err != nil {
+		t.Fatalf("Expected warnings not to fail lint: %v", err)
+	}
+
+	if err := templateLintCmd.Flags().Set("fail-on-warning", "true"); err != nil {
+		t.Fatalf("Failed to set flag: %v", err)
+	}
+	defer func() { _ = templateLintCmd.Flags().Set("fail-on-warning", "false") }()
+
+	if err := templateLintCmd.RunE(templateLintCmd, []string{"good.conf"}); err != nil {
+		t.Errorf("Expected clean template to pass: %v", err)
+	}
+	if err := templateLintCmd.RunE(templateLintCmd, []string{"typo.conf"}); err == nil {
+		t.Error("Expected warning to fail lint with --fail-on-warning")
+	}
+	if err := templateLintCmd.RunE(templateLintCmd, []string{"bad.conf"}); err == nil {
+		t.Error("Expected parse error to fail lint")
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/jvzantvoort/scmt/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxIncludeDepth limits nested include calls so a partial including itself
+// fails instead of exhausting the stack
+const maxIncludeDepth = 64
+
+// TemplateOptions controls how templates are located and rendered
+type TemplateOptions struct {
+	Strict     bool     // fail on missing configuration keys
+	SearchPath []string // template library directories, in order of precedence
+	NoEnv      bool     // env fails, for renders on behalf of API callers
+}
+
+// newTemplateOptions derives the template options from the configuration
+func newTemplateOptions(cfg *config.Config) TemplateOptions {
+	return TemplateOptions{
+		Strict:     cfg.Strict,
+		SearchPath: filepath.SplitList(cfg.Templatedir),
+	}
+}
+
+// resolveTemplate returns the path of a template given either as a file path
+// or as a name relative to one of the directories in the search path. Names
+// that cannot be resolved are returned unchanged.
+func resolveTemplate(name string, searchPath []string) string {
+	if _, err := os.Stat(name); err == nil {
+		return name
+	}
+	if filepath.IsAbs(name) {
+		return name
+	}
+	for _, dir := range searchPath {
+		candidate := filepath.Join(dir, name)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			log.Debugf("Resolved template %s to %s", name, candidate)
+			return candidate
+		}
+	}
+	return name
+}
+
+// libraryFiles returns the files in a template library directory, keyed by
+// their slash separated path relative to the directory. Hidden files and
+// directories are skipped.
+func libraryFiles(dir string) (map[string]string, error) {
+	retv := map[string]string{}
+
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return retv, nil
+	}
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(entry.Name(), ".") && path != dir {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		relpath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		retv[filepath.ToSlash(relpath)] = path
+		return nil
+	})
+	return retv, err
+}
+
+// loadTemplate parses templateFile together with every file in the template
+// library so that {{template "name" .}} and {{include "name" .}} can refer
+// to library files by relative path and to blocks they define. Library files
+// that fail to parse are skipped with a warning, so they only break the
+// templates that include them.
+func loadTemplate(templateFile string, data *TemplateData, opts TemplateOptions) (*template.Template, error) {
+	tmpl, broken, err := parseTemplateSet(templateFile, data, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(broken))
+	for name := range broken {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		log.Warnf("Skipping library template: %v", broken[name])
+	}
+	return tmpl, nil
+}
+
+// parseTemplateSet parses templateFile and the template library like
+// loadTemplate. The library files that failed to parse are returned by
+// name instead of being warned about.
+func parseTemplateSet(templateFile string, data *TemplateData, opts TemplateOptions) (*template.Template, map[string]error, error) {
+	// Read template file
+	templateContent, err := os.ReadFile(templateFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read template file %s: %w", templateFile, err)
+	}
+
+	templateName := filepath.Base(templateFile)
+	tmpl := template.New(templateName)
+
+	depth := 0
+	broken := map[string]error{}
+	funcs := templateFuncs(data)
+	if opts.NoEnv {
+		funcs["env"] = funcNoEnv
+	}
+	funcs["include"] = func(name string, value interface{}) (string, error) {
+		if err, found := broken[name]; found {
+			return "", err
+		}
+		if depth >= maxIncludeDepth {
+			return "", fmt.Errorf("include of %q exceeds maximum depth %d", name, maxIncludeDepth)
+		}
+		depth++
+		defer func() { depth-- }()
+
+		var buf bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&buf, name, value); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+
+	tmpl = tmpl.Funcs(funcs)
+	if opts.Strict {
+		tmpl = tmpl.Option("missingkey=error")
+	}
+
+	// Parse the library with the first directory of the search path last so
+	// its definitions take precedence
+	absTemplate, _ := filepath.Abs(templateFile)
+	for i := len(opts.SearchPath) - 1; i >= 0; i-- {
+		files, err := libraryFiles(opts.SearchPath[i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read template library %s: %w", opts.SearchPath[i], err)
+		}
+		for name, path := range files {
+			if absPath, _ := filepath.Abs(path); absPath == absTemplate {
+				continue
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read template file %s: %w", path, err)
+			}
+			// Parse on its own first, a failed parse would leave an empty
+			// template behind in tmpl
+			if _, err := template.New(name).Funcs(funcs).Parse(string(content)); err != nil {
+				broken[name] = fmt.Errorf("failed to parse template %s: %w", path, err)
+				continue
+			}
+			delete(broken, name)
+			if _, err := tmpl.New(name).Parse(string(content)); err != nil {
+				return nil, nil, fmt.Errorf("failed to parse template %s: %w", path, err)
+			}
+		}
+	}
+
+	// Parse template
+	if _, err := tmpl.Parse(string(templateContent)); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse template %s: %w", templateFile, err)
+	}
+	return tmpl, broken, nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTemplateFiles creates files below dir from a map of relative paths
+func writeTemplateFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create template file %s: %v", name, err)
+		}
+	}
+}
+
+func TestResolveTemplate(t *testing.T) {
+	libDir := t.TempDir()
+	otherDir := t.TempDir()
+	writeTemplateFiles(t, libDir, map[string]string{
+		"app/server.conf": "library",
+	})
+	writeTemplateFiles(t, otherDir, map[string]string{
+		"app/server.conf": "other",
+		"only-other.conf": "other",
+	})
+
+	localFile := filepath.Join(t.TempDir(), "local.conf")
+	writeTemplateFiles(t, filepath.Dir(localFile), map[string]string{"local.conf": "local"})
+
+	searchPath := []string{libDir, otherDir}
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{localFile, localFile},
+		{"app/server.conf", filepath.Join(libDir, "app", "server.conf")},
+		{"only-other.conf", filepath.Join(otherDir, "only-other.conf")},
+		{"missing.conf", "missing.conf"},
+		{"app", "app"},
+	}
+
+	for _, tt := range tests {
+		if got := resolveTemplate(tt.name, searchPath); got != tt.expected {
+			t.Errorf("resolveTemplate(%q): expected %q, got %q", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestLoadTemplate_Library(t *testing.T) {
+	libDir := t.TempDir()
+	overrideDir := t.TempDir()
+	writeTemplateFiles(t, libDir, map[string]string{
+		"header.tmpl":       `{{define "header"}}# Owner: {{.Config.OWNER}}{{end}}`,
+		"partials/tls.tmpl": "ssl = on\nssl_cert = {{.Config.CERT}}",
+		"footer.tmpl":       `{{define "footer"}}# library footer{{end}}`,
+		".hidden/bad.tmpl":  `{{.Broken`,
+	})
+	writeTemplateFiles(t, overrideDir, map[string]string{
+		"footer.tmpl": `{{define "footer"}}# override footer{{end}}`,
+	})
+
+	mainFile := filepath.Join(t.TempDir(), "main.conf")
+	writeTemplateFiles(t, filepath.Dir(mainFile), map[string]string{
+		"main.conf": `{{template "header" .}}
+[tls]
+{{include "partials/tls.tmpl" . | indent 2}}
+{{template "footer" .}}`,
+	})
+
+	td := &TemplateData{Config: map[string]string{"OWNER": "Mad House", "CERT": "/etc/ssl/cert.pem"}}
+	opts := TemplateOptions{SearchPath: []string{overrideDir, libDir}}
+
+	tmpl, err := loadTemplate(mainFile, td, opts)
+	if err != nil {
+		t.Fatalf("Failed to load template: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, td); err != nil {
+		t.Fatalf("Failed to execute template: %v", err)
+	}
+
+	expected := `# Owner: Mad House
+[tls]
+  ssl = on
+  ssl_cert = /etc/ssl/cert.pem
+# override footer`
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestLoadTemplate_IncludeRecursion(t *testing.T) {
+	libDir := t.TempDir()
+	writeTemplateFiles(t, libDir, map[string]string{
+		"loop.tmpl": `{{include "loop.tmpl" .}}`,
+	})
+
+	mainFile := filepath.Join(libDir, "loop.tmpl")
+	td := &TemplateData{}
+	tmpl, err := loadTemplate(mainFile, td, TemplateOptions{SearchPath: []string{libDir}})
+	if err != nil {
+		t.Fatalf("Failed to load template: %v", err)
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, td)
+	if err == nil {
+		t.Fatal("Expected error for recursive include")
+	}
+	if !strings.Contains(err.Error(), "exceeds maximum depth") {
+		t.Errorf("Expected maximum depth error, got: %v", err)
+	}
+}
+
+func TestLoadTemplate_BrokenLibraryFile(t *testing.T) {
+	libDir := t.TempDir()
+	writeTemplateFiles(t, libDir, map[string]string{
+		"header.tmpl": `{{define "header"}}# header{{end}}`,
+		"broken.tmpl": `{{.Broken`,
+		"notes.txt":   `{{ not a template`,
+	})
+
+	// Templates that do not use the broken files still render
+	mainFile := filepath.Join(t.TempDir(), "main.conf")
+	writeTemplateFiles(t, filepath.Dir(mainFile), map[string]string{
+		"main.conf": `{{template "header" .}}`,
+	})
+	td := &TemplateData{}
+	tmpl, err := loadTemplate(mainFile, td, TemplateOptions{SearchPath: []string{libDir}})
+	if err != nil {
+		t.Fatalf("Failed to load template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, td); err != nil || buf.String() != "# header" {
+		t.Errorf("Expected the header, got %q, %v", buf.String(), err)
+	}
+
+	// Including a broken file reports its parse error
+	writeTemplateFiles(t, filepath.Dir(mainFile), map[string]string{
+		"main.conf": `{{include "broken.tmpl" .}}`,
+	})
+	tmpl, err = loadTemplate(mainFile, td, TemplateOptions{SearchPath: []string{libDir}})
+	if err != nil {
+		t.Fatalf("Failed to load template: %v", err)
+	}
+	err = tmpl.Execute(&bytes.Buffer{}, td)
+	if err == nil || !strings.Contains(err.Error(), "broken.tmpl") {
+		t.Errorf("Expected the parse error of broken.tmpl, got %v", err)
+	}
+}
+
+func TestWriteCommand_TemplateName(t *testing.T) {
+	tmpDir := setupTestEnvironment(t)
+	initializeTestData(t)
+
+	writeTemplateFiles(t, filepath.Join(tmpDir, "templates"), map[string]string{
+		"app/server.conf": `{{template "banner" .}}type = {{.Config.TYPE}}`,
+		"banner.tmpl":     `{{define "banner"}}# generated by scmt{{"\n"}}{{end}}`,
+	})
+
+	outputFile := filepath.Join(t.TempDir(), "server.conf")
+	err := WriteCmd.RunE(WriteCmd, []string{"app/server.conf", outputFile})
+	if err != nil {
+		t.Fatalf("Failed to write template by name: %v", err)
+	}
+
+	content, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	expected := "# generated by scmt\ntype = server"
+	if string(content) != expected {
+		t.Errorf("Expected %q, got %q", expected, string(content))
+	}
+}
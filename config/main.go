@@ -2,6 +2,7 @@ package config
 
 import (
 	"path"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -9,8 +10,20 @@ import (
 type Config struct {
 	Configdir      string
 	ConfigDatafile string
+	Statefile      string
+	Catalogfile    string
+	Tokenfile      string
+	Notifyfile     string
+	Spooldir       string
+	Hooksdir       string
+	HookTimeout    time.Duration
 	Logfile        string
 	OutputJSON     bool
+	Strict         bool
+	Reproducible   bool
+	Templatedir    string
+	Rolesdir       string
+	Rootdir        string
 }
 
 func New() *Config {
@@ -19,7 +32,29 @@ func New() *Config {
 	retv.Configdir = viper.GetString("configdir")
 	retv.Logfile = viper.GetString("logfile")
 	retv.OutputJSON = viper.GetBool("json")
+	retv.Strict = viper.GetBool("strict")
+	retv.Reproducible = viper.GetBool("reproducible")
 	retv.ConfigDatafile = path.Join(retv.Configdir, "data.json")
+	retv.Statefile = path.Join(retv.Configdir, "state.json")
+	retv.Catalogfile = path.Join(retv.Configdir, "catalog.json")
+	retv.Tokenfile = path.Join(retv.Configdir, "tokens.json")
+	retv.Notifyfile = path.Join(retv.Configdir, "notify.json")
+	retv.Spooldir = path.Join(retv.Configdir, "spool")
+	retv.Hooksdir = path.Join(retv.Configdir, "hooks.d")
+	retv.HookTimeout = viper.GetDuration("hooktimeout")
+	retv.Rolesdir = path.Join(retv.Configdir, "roles")
+
+	// Rootdir prefixes the destination of files rendered from role templates
+	retv.Rootdir = viper.GetString("rootdir")
+	if len(retv.Rootdir) == 0 {
+		retv.Rootdir = "/"
+	}
+
+	// Templatedir may hold a list of directories, separated like $PATH
+	retv.Templatedir = viper.GetString("templatedir")
+	if len(retv.Templatedir) == 0 {
+		retv.Templatedir = path.Join(retv.Configdir, "templates")
+	}
 
 	return retv
 }
@@ -35,6 +35,22 @@ func TestNew(t *testing.T) {
 		t.Errorf("Expected ConfigDatafile '%s', got '%s'", expectedDataFile, cfg.ConfigDatafile)
 	}
 
+	if cfg.Catalogfile != "/test/config/catalog.json" {
+		t.Errorf("Expected Catalogfile '/test/config/catalog.json', got '%s'", cfg.Catalogfile)
+	}
+
+	if cfg.Tokenfile != "/test/config/tokens.json" {
+		t.Errorf("Expected Tokenfile '/test/config/tokens.json', got '%s'", cfg.Tokenfile)
+	}
+
+	if cfg.Notifyfile != "/test/config/notify.json" || cfg.Spooldir != "/test/config/spool" {
+		t.Errorf("Unexpected Notifyfile '%s' or Spooldir '%s'", cfg.Notifyfile, cfg.Spooldir)
+	}
+
+	if cfg.Hooksdir != "/test/config/hooks.d" {
+		t.Errorf("Expected Hooksdir '/test/config/hooks.d', got '%s'", cfg.Hooksdir)
+	}
+
 	// Clean up
 	viper.Reset()
 }
@@ -67,6 +83,19 @@ func TestNew_DefaultValues(t *testing.T) {
 		t.Errorf("Expected ConfigDatafile '%s', got '%s'", expectedDataFile, cfg.ConfigDatafile)
 	}
 
+	expectedTemplatedir := "/etc/scmt/templates"
+	if cfg.Templatedir != expectedTemplatedir {
+		t.Errorf("Expected Templatedir '%s', got '%s'", expectedTemplatedir, cfg.Templatedir)
+	}
+
+	if cfg.Rolesdir != "/etc/scmt/roles" {
+		t.Errorf("Expected Rolesdir '/etc/scmt/roles', got '%s'", cfg.Rolesdir)
+	}
+
+	if cfg.Rootdir != "/" {
+		t.Errorf("Expected Rootdir '/', got '%s'", cfg.Rootdir)
+	}
+
 	// Clean up
 	viper.Reset()
 }
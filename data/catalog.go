@@ -0,0 +1,134 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/jvzantvoort/scmt/utils"
+)
+
+// CatalogRole declares a known role: the roles it needs, the roles it
+// cannot be combined with and the options it sets by default.
+type CatalogRole struct {
+	Description string            `json:"description,omitempty"`
+	Requires    []string          `json:"requires,omitempty"`
+	Conflicts   []string          `json:"conflicts,omitempty"`
+	Options     map[string]string `json:"options,omitempty"`
+}
+
+// Catalog holds the known roles. In strict mode roles missing from the
+// catalog cannot be added.
+type Catalog struct {
+	Catalogfile string                 `json:"-"`
+	Strict      bool                   `json:"strict"`
+	Roles       map[string]CatalogRole `json:"roles"`
+}
+
+// Known returns true when the role is declared in the catalog
+func (c Catalog) Known(role string) bool {
+	_, found := c.Roles[role]
+	return found
+}
+
+// Conflicting returns true when either role declares a conflict with the other
+func (c Catalog) Conflicting(role, other string) bool {
+	for _, conflict := range c.Roles[role].Conflicts {
+		if conflict == other {
+			return true
+		}
+	}
+	for _, conflict := range c.Roles[other].Conflicts {
+		if conflict == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the role preceded by everything it requires, dependencies
+// first and each role once
+func (c Catalog) Resolve(role string) ([]string, error) {
+	retv := []string{}
+	done := map[string]bool{}
+	visiting := map[string]bool{}
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		if done[name] {
+			return nil
+		}
+		if visiting[name] {
+			return fmt.Errorf("role %s requires itself", name)
+		}
+		visiting[name] = true
+		for _, required := range c.Roles[name].Requires {
+			if err := visit(required); err != nil {
+				return err
+			}
+		}
+		visiting[name] = false
+		done[name] = true
+		retv = append(retv, name)
+		return nil
+	}
+
+	if err := visit(role); err != nil {
+		return nil, err
+	}
+	return retv, nil
+}
+
+// RequiredBy returns the roles, out of the given roles, that require role
+func (c Catalog) RequiredBy(role string, roles []string) []string {
+	retv := []string{}
+	for _, name := range roles {
+		for _, required := range c.Roles[name].Requires {
+			if required == role {
+				retv = append(retv, name)
+				break
+			}
+		}
+	}
+	sort.Strings(retv)
+	return retv
+}
+
+// Open reads the catalog file, a missing file is an empty catalog
+func (c *Catalog) Open() error {
+	utils.LogStart()
+	defer utils.LogEnd()
+
+	if _, err := os.Stat(c.Catalogfile); os.IsNotExist(err) {
+		return nil
+	}
+
+	content, err := os.ReadFile(c.Catalogfile)
+	if err != nil {
+		return fmt.Errorf("failed to read role catalog %s: %w", c.Catalogfile, err)
+	}
+	if err := json.Unmarshal(content, c); err != nil {
+		return fmt.Errorf("failed to parse role catalog %s: %w", c.Catalogfile, err)
+	}
+	if c.Roles == nil {
+		c.Roles = map[string]CatalogRole{}
+	}
+	return nil
+}
+
+// NewCatalog returns the role catalog stored in file
+func NewCatalog(file string) (*Catalog, error) {
+	retv := &Catalog{}
+	retv.Catalogfile = file
+	retv.Roles = map[string]CatalogRole{}
+	if err := retv.Open(); err != nil {
+		return nil, err
+	}
+	return retv, nil
+}
+
+// Catalog returns the role catalog of the configuration directory
+func (d Data) Catalog() (*Catalog, error) {
+	return NewCatalog(d.Config.Catalogfile)
+}
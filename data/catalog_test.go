@@ -0,0 +1,148 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testCatalog = `{
+  "roles": {
+    "web-server": {
+      "description": "Public web frontend",
+      "requires": ["tls-client"],
+      "options": {"HTTP_PORT": "80", "OWNER": "Web team"}
+    },
+    "tls-client": {},
+    "database": {"conflicts": ["bastion"]},
+    "bastion": {}
+  }
+}`
+
+// newCatalogTestData returns test data with the given role catalog
+func newCatalogTestData(t *testing.T, catalog string) *Data {
+	t.Helper()
+	d := newTestData(t)
+	d.Config.Catalogfile = filepath.Join(d.Config.Configdir, "catalog.json")
+	if err := os.WriteFile(d.Config.Catalogfile, []byte(catalog), 0644); err != nil {
+		t.Fatalf("Failed to write catalog: %v", err)
+	}
+	return d
+}
+
+func TestCatalog_Resolve(t *testing.T) {
+	catalog := Catalog{Roles: map[string]CatalogRole{
+		"app":   {Requires: []string{"web", "db"}},
+		"web":   {Requires: []string{"tls"}},
+		"db":    {Requires: []string{"tls"}},
+		"loopy": {Requires: []string{"loopy"}},
+	}}
+
+	roles, err := catalog.Resolve("app")
+	if err != nil {
+		t.Fatalf("Failed to resolve: %v", err)
+	}
+	if strings.Join(roles, ",") != "tls,web,db,app" {
+		t.Errorf("Expected tls,web,db,app, got %v", roles)
+	}
+
+	if _, err := catalog.Resolve("loopy"); err == nil {
+		t.Error("Expected error for a role requiring itself")
+	}
+}
+
+func TestNewCatalog_Missing(t *testing.T) {
+	catalog, err := NewCatalog(filepath.Join(t.TempDir(), "catalog.json"))
+	if err != nil {
+		t.Fatalf("Expected no error for a missing catalog: %v", err)
+	}
+	if len(catalog.Roles) != 0 || catalog.Strict {
+		t.Errorf("Expected an empty catalog, got %+v", catalog)
+	}
+}
+
+func TestData_AddRole_Requires(t *testing.T) {
+	d := newCatalogTestData(t, testCatalog)
+	if _, err := d.Set("OWNER", "Mad House", "testuser", "test"); err != nil {
+		t.Fatalf("Failed to set option: %v", err)
+	}
+
+	changed, err := d.AddRole("web-server", "testuser", "test")
+	if err != nil {
+		t.Fatalf("Failed to add role: %v", err)
+	}
+	if !changed {
+		t.Error("Expected AddRole to return true")
+	}
+	if strings.Join(d.ListRoles(), ",") != "tls-client,web-server" {
+		t.Errorf("Expected the required role to be added first, got %v", d.ListRoles())
+	}
+
+	role, _ := d.GetRole("web-server")
+	if role.Description != "Public web frontend" {
+		t.Errorf("Expected the catalog description, got '%s'", role.Description)
+	}
+
+	// Default options are layered under explicitly set options
+	if _, err := d.Get("HTTP_PORT"); err == nil {
+		t.Error("Expected HTTP_PORT not to be set explicitly")
+	}
+	if value, _ := d.GetEffective("HTTP_PORT"); value.Value != "80" || value.Role != "web-server" {
+		t.Errorf("Expected HTTP_PORT to default to 80 from web-server, got %+v", value)
+	}
+	if value, _ := d.GetEffective("OWNER"); value.Value != "Mad House" || value.Source != SourceExplicit {
+		t.Errorf("Expected OWNER to keep its explicit value, got %+v", value)
+	}
+
+	// A required role cannot be removed
+	if _, err := d.RemoveRole("tls-client", "testuser", "test"); err == nil {
+		t.Error("Expected error removing a role required by another")
+	}
+	if _, err := d.RemoveRole("web-server", "testuser", "test"); err != nil {
+		t.Fatalf("Failed to remove role: %v", err)
+	}
+	if _, err := d.RemoveRole("tls-client", "testuser", "test"); err != nil {
+		t.Errorf("Expected tls-client to be removable, got %v", err)
+	}
+}
+
+func TestData_AddRole_Conflicts(t *testing.T) {
+	d := newCatalogTestData(t, testCatalog)
+
+	if _, err := d.AddRole("bastion", "testuser", "test"); err != nil {
+		t.Fatalf("Failed to add role: %v", err)
+	}
+
+	// The conflict is declared by database only, it applies both ways
+	_, err := d.AddRole("database", "testuser", "test")
+	if err == nil || !strings.Contains(err.Error(), "conflicts") {
+		t.Errorf("Expected conflict error, got %v", err)
+	}
+	if d.HasRole("database") {
+		t.Error("Expected database not to be added")
+	}
+}
+
+func TestData_AddRole_Strict(t *testing.T) {
+	d := newCatalogTestData(t, testCatalog)
+
+	// Unknown roles are allowed unless strict
+	if _, err := d.AddRole("mailserver", "testuser", "test"); err != nil {
+		t.Fatalf("Expected unknown role to be added: %v", err)
+	}
+
+	// Strict templates do not make the catalog strict
+	d.Config.Strict = true
+	if _, err := d.AddRole("ftp-server", "testuser", "test"); err != nil {
+		t.Errorf("Expected unknown role to be added with strict templates: %v", err)
+	}
+
+	d = newCatalogTestData(t, `{"strict": true, "roles": {"database": {}}}`)
+	if _, err := d.AddRole("mailserver", "testuser", "test"); err == nil {
+		t.Error("Expected error adding an unknown role with a strict catalog")
+	}
+	if _, err := d.AddRole("database", "testuser", "test"); err != nil {
+		t.Errorf("Expected catalog role to be added with a strict catalog: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Sources of an effective configuration value
+const (
+	SourceExplicit string = "explicit"
+	SourceRole     string = "role"
+)
+
+// EffectiveValue is a configuration value together with where it came from
+type EffectiveValue struct {
+	Option   string     `json:"option"`
+	Value    string     `json:"value"`
+	Source   string     `json:"source"`
+	Role     string     `json:"role,omitempty"`
+	Engineer string     `json:"engineer,omitempty"`
+	Message  string     `json:"message,omitempty"`
+	Changed  *time.Time `json:"changed,omitempty"`
+}
+
+// Effective returns the effective configuration sorted by option: the
+// explicitly set elements layered over the default options the role catalog
+// declares for the assigned roles. When several roles default the same
+// option the role assigned first wins.
+func (d Data) Effective() ([]EffectiveValue, error) {
+	catalog, err := d.Catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]EffectiveValue{}
+	for _, role := range d.Roles {
+		for option, value := range catalog.Roles[role.Name].Options {
+			if _, found := values[option]; found {
+				continue
+			}
+			values[option] = EffectiveValue{
+				Option: option,
+				Value:  value,
+				Source: SourceRole,
+				Role:   role.Name,
+			}
+		}
+	}
+
+	for _, element := range d.Elements {
+		changed := element.Value.Changed
+		values[element.Option] = EffectiveValue{
+			Option:   element.Option,
+			Value:    element.Value.Value,
+			Source:   SourceExplicit,
+			Engineer: element.Value.Engineer,
+			Message:  element.Value.Message,
+			Changed:  &changed,
+		}
+	}
+
+	retv := make([]EffectiveValue, 0, len(values))
+	for _, value := range values {
+		retv = append(retv, value)
+	}
+	sort.Slice(retv, func(i, j int) bool { return retv[i].Option < retv[j].Option })
+	return retv, nil
+}
+
+// EffectiveMap returns the effective configuration as option/value map
+func (d Data) EffectiveMap() (map[string]string, error) {
+	values, err := d.Effective()
+	if err != nil {
+		return nil, err
+	}
+
+	retv := make(map[string]string, len(values))
+	for _, value := range values {
+		retv[value.Option] = value.Value
+	}
+	return retv, nil
+}
+
+// GetEffective returns the effective value of an option
+func (d Data) GetEffective(option string) (*EffectiveValue, error) {
+	values, err := d.Effective()
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range values {
+		if value.Option == option {
+			return &value, nil
+		}
+	}
+	return &EffectiveValue{}, fmt.Errorf("option %s not found", option)
+}
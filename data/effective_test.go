@@ -0,0 +1,75 @@
+package data
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestData_Effective(t *testing.T) {
+	d := newCatalogTestData(t, `{
+  "roles": {
+    "database": {"options": {"DB_PORT": "5432", "BACKUP_WINDOW": "02:00"}},
+    "reporting": {"options": {"DB_PORT": "6432", "REPORT_DAY": "monday"}}
+  }
+}`)
+
+	if _, err := d.AddRole("database", "testuser", "test"); err != nil {
+		t.Fatalf("Failed to add role: %v", err)
+	}
+	if _, err := d.AddRole("reporting", "testuser", "test"); err != nil {
+		t.Fatalf("Failed to add role: %v", err)
+	}
+	if _, err := d.Set("BACKUP_WINDOW", "03:00", "testuser", "test"); err != nil {
+		t.Fatalf("Failed to set option: %v", err)
+	}
+
+	values, err := d.Effective()
+	if err != nil {
+		t.Fatalf("Failed to compute effective configuration: %v", err)
+	}
+
+	expected := []EffectiveValue{
+		{Option: "BACKUP_WINDOW", Value: "03:00", Source: SourceExplicit},
+		{Option: "DB_PORT", Value: "5432", Source: SourceRole, Role: "database"},
+		{Option: "REPORT_DAY", Value: "monday", Source: SourceRole, Role: "reporting"},
+	}
+	if len(values) != len(expected) {
+		t.Fatalf("Expected %d values, got %+v", len(expected), values)
+	}
+	for i, value := range values {
+		if value.Option != expected[i].Option || value.Value != expected[i].Value || value.Source != expected[i].Source || value.Role != expected[i].Role {
+			t.Errorf("Expected %+v, got %+v", expected[i], value)
+		}
+	}
+	if values[0].Changed == nil || values[1].Changed != nil {
+		t.Error("Expected only explicit values to have a change time")
+	}
+
+	mdata, err := d.EffectiveMap()
+	if err != nil {
+		t.Fatalf("Failed to compute effective map: %v", err)
+	}
+	if mdata["DB_PORT"] != "5432" {
+		t.Errorf("Expected DB_PORT 5432, got '%s'", mdata["DB_PORT"])
+	}
+
+	// Removing the role removes its defaults
+	if _, err := d.RemoveRole("database", "testuser", "test"); err != nil {
+		t.Fatalf("Failed to remove role: %v", err)
+	}
+	if value, _ := d.GetEffective("DB_PORT"); value.Value != "6432" {
+		t.Errorf("Expected DB_PORT 6432 from reporting, got '%s'", value.Value)
+	}
+	if _, err := d.GetEffective("NONEXISTENT"); err == nil {
+		t.Error("Expected error for unknown option")
+	}
+
+	var buf bytes.Buffer
+	if err := d.Explain("table", &buf); err != nil {
+		t.Fatalf("Failed to explain: %v", err)
+	}
+	if !strings.Contains(buf.String(), "role reporting") || !strings.Contains(buf.String(), "explicit") {
+		t.Errorf("Expected sources in explain output, got: %s", buf.String())
+	}
+}
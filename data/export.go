@@ -0,0 +1,320 @@
+package data
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+
+	"github.com/jvzantvoort/scmt/utils"
+)
+
+// Export formats, next to the import formats
+const (
+	FormatTOML     string = "toml"
+	FormatCSV      string = "csv"
+	FormatMarkdown string = "markdown"
+	FormatShell    string = "shell"
+	FormatSystemd  string = "systemd"
+	FormatAnsible  string = "ansible"
+)
+
+// ExportFormats lists the supported export formats
+var ExportFormats = []string{FormatEnv, FormatShell, FormatSystemd, FormatJSON, FormatYAML, FormatTOML, FormatINI, FormatCSV, FormatMarkdown, FormatAnsible}
+
+var (
+	// safeValue matches values that need no quoting in env files
+	safeValue = regexp.MustCompile(`^[A-Za-z0-9_./:,@%+-]*$`)
+
+	// invalidName matches the characters not allowed in shell variable names
+	invalidName = regexp.MustCompile(`[^A-Za-z0-9_]`)
+)
+
+// exportData is the layout of the structured export formats
+type exportData struct {
+	Config map[string]string `json:"config" yaml:"config" toml:"config"`
+	Roles  []string          `json:"roles" yaml:"roles" toml:"roles"`
+}
+
+// AnsibleMetadata describes where an exported value came from
+type AnsibleMetadata struct {
+	Source   string     `json:"source"`
+	Role     string     `json:"role,omitempty"`
+	Engineer string     `json:"engineer,omitempty"`
+	Message  string     `json:"message,omitempty"`
+	Changed  *time.Time `json:"changed,omitempty"`
+}
+
+// AnsibleFacts is the layout of the Ansible local facts, exposed by Ansible
+// as ansible_local.scmt. Changing it breaks playbooks, so only add fields.
+type AnsibleFacts struct {
+	Config   map[string]string          `json:"config"`
+	Roles    []string                   `json:"roles"`
+	Metadata map[string]AnsibleMetadata `json:"metadata"`
+}
+
+// Export writes the effective configuration in the given format with every
+// option prefixed with prefix, followed by the roles: a list in the
+// structured formats, a section in INI and markdown, and the comma separated
+// roles in RolesVariable in the env, shell, systemd and CSV formats.
+func (d Data) Export(format, prefix string, writer io.Writer) error {
+	utils.LogStart()
+	defer utils.LogEnd()
+
+	values, err := d.Effective()
+	if err != nil {
+		return err
+	}
+
+	options := make([]string, 0, len(values))
+	config := make(map[string]string, len(values))
+	for _, value := range values {
+		option := prefix + value.Option
+		options = append(options, option)
+		config[option] = value.Value
+	}
+	roles := d.ListRoles()
+
+	switch format {
+	case FormatEnv, FormatShell, FormatSystemd:
+		names, err := shellNames(options)
+		if err != nil {
+			return err
+		}
+		names[RolesVariable] = RolesVariable
+		config[RolesVariable] = strings.Join(roles, ",")
+		for _, option := range append(options, RolesVariable) {
+			var line string
+			switch format {
+			case FormatEnv:
+				line = fmt.Sprintf("%s=%s", names[option], envQuote(config[option]))
+			case FormatShell:
+				line = fmt.Sprintf("export %s=%s", names[option], shellQuote(config[option]))
+			default:
+				line = fmt.Sprintf("%s=%s", names[option], systemdQuote(config[option]))
+			}
+			if _, err := fmt.Fprintln(writer, line); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case FormatAnsible:
+		facts := AnsibleFacts{Config: config, Roles: roles, Metadata: map[string]AnsibleMetadata{}}
+		for _, value := range values {
+			facts.Metadata[prefix+value.Option] = AnsibleMetadata{
+				Source:   value.Source,
+				Role:     value.Role,
+				Engineer: value.Engineer,
+				Message:  value.Message,
+				Changed:  value.Changed,
+			}
+		}
+		content, err := json.MarshalIndent(facts, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(writer, "%s\n", string(content))
+		return err
+
+	case FormatJSON:
+		content, err := json.MarshalIndent(exportData{Config: config, Roles: roles}, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(writer, "%s\n", string(content))
+		return err
+
+	case FormatYAML:
+		encoder := yaml.NewEncoder(writer)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(exportData{Config: config, Roles: roles}); err != nil {
+			return err
+		}
+		return encoder.Close()
+
+	case FormatTOML:
+		return toml.NewEncoder(writer).Encode(exportData{Config: config, Roles: roles})
+
+	case FormatINI:
+		if _, err := fmt.Fprintln(writer, "[config]"); err != nil {
+			return err
+		}
+		for _, option := range options {
+			if _, err := fmt.Fprintf(writer, "%s = %s\n", option, iniQuote(config[option])); err != nil {
+				return err
+			}
+		}
+		if len(roles) == 0 {
+			return nil
+		}
+		if _, err := fmt.Fprintln(writer, "\n[roles]"); err != nil {
+			return err
+		}
+		for _, role := range roles {
+			if _, err := fmt.Fprintf(writer, "%s = true\n", role); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case FormatCSV:
+		if _, found := config[RolesVariable]; found {
+			return fmt.Errorf("option %s is the row holding the roles", RolesVariable)
+		}
+		csvWriter := csv.NewWriter(writer)
+		if err := csvWriter.Write([]string{"option", "value"}); err != nil {
+			return err
+		}
+		for _, option := range options {
+			if err := csvWriter.Write([]string{option, config[option]}); err != nil {
+				return err
+			}
+		}
+		if err := csvWriter.Write([]string{RolesVariable, strings.Join(roles, ",")}); err != nil {
+			return err
+		}
+		csvWriter.Flush()
+		return csvWriter.Error()
+
+	case FormatMarkdown:
+		lines := []string{"## Configuration", "", "| Option | Value |", "| --- | --- |"}
+		for _, option := range options {
+			lines = append(lines, fmt.Sprintf("| %s | %s |", markdownEscape(option), markdownEscape(config[option])))
+		}
+		if len(roles) > 0 {
+			lines = append(lines, "", "## Roles", "")
+			for _, role := range roles {
+				lines = append(lines, fmt.Sprintf("- %s", markdownEscape(role)))
+			}
+		}
+		_, err := fmt.Fprintln(writer, strings.Join(lines, "\n"))
+		return err
+	}
+
+	return fmt.Errorf("unsupported export format %q, use one of %s", format, strings.Join(ExportFormats, ", "))
+}
+
+// RolesVariable is the environment variable holding the comma separated roles
+const RolesVariable string = "SCMT_ROLES"
+
+// Environ returns the effective configuration as KEY=VALUE environment
+// entries, with the keys prefixed and made valid variable names, followed by
+// the roles in RolesVariable. With only, just the listed options are
+// returned and each of them must exist.
+func (d Data) Environ(prefix string, only []string) ([]string, error) {
+	values, err := d.Effective()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(only) > 0 {
+		selected := []EffectiveValue{}
+		for _, option := range only {
+			value, err := d.GetEffective(option)
+			if err != nil {
+				return nil, err
+			}
+			selected = append(selected, *value)
+		}
+		values = selected
+	}
+
+	options := make([]string, 0, len(values))
+	for _, value := range values {
+		options = append(options, prefix+value.Option)
+	}
+	names, err := shellNames(options)
+	if err != nil {
+		return nil, err
+	}
+
+	retv := make([]string, 0, len(values)+1)
+	for _, value := range values {
+		retv = append(retv, fmt.Sprintf("%s=%s", names[prefix+value.Option], value.Value))
+	}
+	retv = append(retv, fmt.Sprintf("%s=%s", RolesVariable, strings.Join(d.ListRoles(), ",")))
+	return retv, nil
+}
+
+// shellName turns an option into a valid shell variable name
+func shellName(option string) string {
+	name := invalidName.ReplaceAllString(option, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// shellNames returns the shell variable names of the options, failing when
+// two options get the same name, like my.key and my_key, or an option gets
+// the name of RolesVariable
+func shellNames(options []string) (map[string]string, error) {
+	retv := make(map[string]string, len(options))
+	seen := map[string]string{}
+	for _, option := range options {
+		name := shellName(option)
+		if name == RolesVariable {
+			return nil, fmt.Errorf("option %s becomes variable %s, which holds the roles", option, name)
+		}
+		if other, found := seen[name]; found && other != option {
+			return nil, fmt.Errorf("options %s and %s both become variable %s", other, option, name)
+		}
+		seen[name] = option
+		retv[option] = name
+	}
+	return retv, nil
+}
+
+// shellQuote quotes a value for POSIX shells
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// envQuote quotes a value for env files when needed, single quotes unless
+// the value holds single quotes or newlines. Within double quotes backslash,
+// double quote, backtick and dollar are escaped like systemdQuote does, and
+// newlines are written as \n so every value stays on one line.
+func envQuote(value string) string {
+	if safeValue.MatchString(value) {
+		return value
+	}
+	if !strings.ContainsAny(value, "'\n") {
+		return "'" + value + "'"
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", `$`, `\$`, "\n", `\n`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+// systemdQuote quotes a value for systemd EnvironmentFile= files when
+// needed. Within double quotes systemd reads newlines as is and only needs
+// backslash, double quote, backtick and dollar escaped.
+func systemdQuote(value string) string {
+	if safeValue.MatchString(value) {
+		return value
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", `$`, `\$`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+// iniQuote quotes a value for INI files when it would not be read back as is
+func iniQuote(value string) string {
+	if value == strings.TrimSpace(value) && !strings.ContainsAny(value, "\"';#\n") {
+		return value
+	}
+	return strconv.Quote(value)
+}
+
+// markdownEscape escapes a value for a markdown table cell
+func markdownEscape(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "|", `\|`)
+	return strings.ReplaceAll(value, "\n", "<br>")
+}
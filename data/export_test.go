@@ -0,0 +1,228 @@
+package data
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newExportTestData returns test data with awkward values and a role
+func newExportTestData(t *testing.T) *Data {
+	t.Helper()
+	d := newTestData(t)
+	values := map[string]string{
+		"OWNER":   "Mad House",
+		"NOTE":    `it's a "test" | $HOME`,
+		"TYPE":    "server",
+		"my.key":  "a\nb",
+		"PADDING": " x ",
+		"CAFE":    "l'été `date`",
+	}
+	for option, value := range values {
+		if _, err := d.Set(option, value, "testuser", "test"); err != nil {
+			t.Fatalf("Failed to set option: %v", err)
+		}
+	}
+	if _, err := d.AddRole("web-server", "testuser", "test"); err != nil {
+		t.Fatalf("Failed to add role: %v", err)
+	}
+	return d
+}
+
+func TestData_Export_RoundTrip(t *testing.T) {
+	d := newExportTestData(t)
+
+	for _, format := range []string{FormatEnv, FormatINI, FormatJSON, FormatYAML} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := d.Export(format, "", &buf); err != nil {
+				t.Fatalf("Failed to export: %v", err)
+			}
+
+			options, err := ParseImport(format, buf.Bytes())
+			if err != nil {
+				t.Fatalf("Failed to read back export: %v\n%s", err, buf.String())
+			}
+
+			// Sections and nested keys are read back with their prefix
+			prefix := ""
+			if format != FormatEnv {
+				prefix = "config_"
+			}
+			for _, element := range d.Elements {
+				option := prefix + element.Option
+				if format == FormatEnv {
+					option = shellName(element.Option)
+				}
+				if options[option] != element.Value.Value {
+					t.Errorf("Expected %s=%q, got %q", option, element.Value.Value, options[option])
+				}
+			}
+			if _, found := options[RolesVariable]; found {
+				t.Errorf("Expected the roles not to be read back as an option")
+			}
+		})
+	}
+}
+
+func TestData_Export(t *testing.T) {
+	d := newExportTestData(t)
+
+	tests := []struct {
+		format   string
+		expected []string
+	}{
+		{FormatEnv, []string{"SCMT_OWNER='Mad House'\n", "SCMT_TYPE=server\n", "SCMT_my_key=\"a\\nb\"\n", "SCMT_NOTE=\"it's a \\\"test\\\" | \\$HOME\"\n", "SCMT_CAFE=\"l'été \\`date\\`\"\n", "SCMT_ROLES=web-server\n"}},
+		{FormatShell, []string{"export SCMT_NOTE='it'\\''s a \"test\" | $HOME'\n", "export SCMT_TYPE='server'\n", "export SCMT_ROLES='web-server'\n"}},
+		{FormatSystemd, []string{"SCMT_NOTE=\"it's a \\\"test\\\" | \\$HOME\"\n", "SCMT_my_key=\"a\nb\"\n", "SCMT_TYPE=server\n", "SCMT_ROLES=web-server\n"}},
+		{FormatTOML, []string{"roles = ['web-server']", "[config]", "SCMT_TYPE = 'server'"}},
+		{FormatINI, []string{"[config]\n", "SCMT_PADDING = \" x \"\n", "[roles]\nweb-server = true\n"}},
+		{FormatCSV, []string{"option,value\n", "SCMT_NOTE,\"it's a \"\"test\"\" | $HOME\"\n", "SCMT_ROLES,web-server\n"}},
+		{FormatMarkdown, []string{"| SCMT_NOTE | it's a \"test\" \\| $HOME |", "| SCMT_my.key | a<br>b |", "## Roles\n\n- web-server"}},
+		{FormatYAML, []string{"roles:\n  - web-server\n"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := d.Export(tt.format, "SCMT_", &buf); err != nil {
+				t.Fatalf("Failed to export: %v", err)
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(buf.String(), expected) {
+					t.Errorf("Expected output to contain %q, got:\n%s", expected, buf.String())
+				}
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := d.Export("xml", "", &buf); err == nil {
+		t.Error("Expected error for an unsupported format")
+	}
+}
+
+func TestShellName(t *testing.T) {
+	tests := map[string]string{
+		"OWNER":     "OWNER",
+		"my.key":    "my_key",
+		"web-port":  "web_port",
+		"1ST_VALUE": "_1ST_VALUE",
+	}
+	for option, expected := range tests {
+		if got := shellName(option); got != expected {
+			t.Errorf("shellName(%q): expected %q, got %q", option, expected, got)
+		}
+	}
+}
+
+func TestData_Export_NameCollision(t *testing.T) {
+	d := newTestData(t)
+	_, _ = d.Set("my.key", "a", "testuser", "test")
+	_, _ = d.Set("my_key", "b", "testuser", "test")
+
+	for _, format := range []string{FormatEnv, FormatShell, FormatSystemd} {
+		if err := d.Export(format, "", &bytes.Buffer{}); err == nil {
+			t.Errorf("Expected error for colliding variable names in %s", format)
+		}
+	}
+	if _, err := d.Environ("", nil); err == nil {
+		t.Error("Expected error for colliding variable names in the environment")
+	}
+
+	// Other formats keep the option names
+	if err := d.Export(FormatJSON, "", &bytes.Buffer{}); err != nil {
+		t.Errorf("Expected JSON export to work: %v", err)
+	}
+
+	// No option may take the place of the roles
+	d = newTestData(t)
+	_, _ = d.Set(RolesVariable, "web-server", "testuser", "test")
+	for _, format := range []string{FormatEnv, FormatShell, FormatSystemd, FormatCSV} {
+		if err := d.Export(format, "", &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), RolesVariable) {
+			t.Errorf("Expected error for option %s in %s, got %v", RolesVariable, format, err)
+		}
+	}
+	if _, err := d.Environ("", nil); err == nil {
+		t.Errorf("Expected error for option %s in the environment", RolesVariable)
+	}
+	if err := d.Export(FormatEnv, "APP_", &bytes.Buffer{}); err != nil {
+		t.Errorf("Expected a prefixed %s to work: %v", RolesVariable, err)
+	}
+}
+
+func TestData_Environ(t *testing.T) {
+	d := newExportTestData(t)
+
+	environ, err := d.Environ("SCMT_", nil)
+	if err != nil {
+		t.Fatalf("Failed to build environment: %v", err)
+	}
+	expected := []string{"SCMT_NOTE=it's a \"test\" | $HOME", "SCMT_my_key=a\nb", "SCMT_ROLES=web-server"}
+	for _, entry := range expected {
+		found := false
+		for _, got := range environ {
+			if got == entry {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected %q in %v", entry, environ)
+		}
+	}
+
+	environ, err = d.Environ("", []string{"TYPE"})
+	if err != nil {
+		t.Fatalf("Failed to build environment: %v", err)
+	}
+	if strings.Join(environ, ";") != "TYPE=server;SCMT_ROLES=web-server" {
+		t.Errorf("Expected only TYPE and the roles, got %v", environ)
+	}
+
+	if _, err := d.Environ("", []string{"NONEXISTENT"}); err == nil {
+		t.Error("Expected error for an unknown option")
+	}
+}
+
+// TestData_Export_AnsibleShape guards the layout Ansible playbooks rely on
+// as ansible_local.scmt
+func TestData_Export_AnsibleShape(t *testing.T) {
+	d := newCatalogTestData(t, `{"roles": {"database": {"options": {"DB_PORT": "5432"}}}}`)
+	changed := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	d.Elements = []DataElement{
+		{Option: "TYPE", Value: DataElementValue{Value: "server", Engineer: "alice", Message: "Initialize", Changed: changed}},
+	}
+	d.Roles = []Role{{Name: "database"}}
+
+	var buf bytes.Buffer
+	if err := d.Export(FormatAnsible, "", &buf); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	expected := `{
+  "config": {
+    "DB_PORT": "5432",
+    "TYPE": "server"
+  },
+  "roles": [
+    "database"
+  ],
+  "metadata": {
+    "DB_PORT": {
+      "source": "role",
+      "role": "database"
+    },
+    "TYPE": {
+      "source": "explicit",
+      "engineer": "alice",
+      "message": "Initialize",
+      "changed": "2026-01-02T03:04:05Z"
+    }
+  }
+}
+`
+	if buf.String() != expected {
+		t.Errorf("Ansible facts changed shape, expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
@@ -0,0 +1,51 @@
+package data
+
+import (
+	"github.com/jvzantvoort/scmt/notify"
+	log "github.com/sirupsen/logrus"
+)
+
+// Audit log options of the change hooks
+const (
+	HookVetoOption   string = "HOOK_VETO"
+	HookFailedOption string = "HOOK_FAILED"
+)
+
+// hooks returns the change hooks in the hooks directory
+func (d Data) hooks() notify.Hooks {
+	return notify.NewHooks(d.Config.Hooksdir, d.Config.HookTimeout)
+}
+
+// PreChange runs the pre- hooks for a change that is about to be made. When
+// a hook vetoes the change the veto is recorded in the audit log and
+// returned, and the change must not be made.
+func (d Data) PreChange(option, old, value, engineer, message string) error {
+	err := d.hooks().RunPre(notify.NewEvent(option, old, value, engineer, message))
+	if err != nil {
+		if err := d.Log(HookVetoOption, option, engineer, err.Error()); err != nil {
+			log.Warnf("Failed to log hook veto: %v", err)
+		}
+	}
+	return err
+}
+
+// RunPostHooks runs the hooks for the changes recorded by LogChange since
+// the last call, once they are committed, and queues the changes for
+// SendNotifications. Save calls it after writing the data file. Failing
+// hooks are logged and recorded in the audit log, they do not undo the
+// change.
+func (d *Data) RunPostHooks() {
+	pending := d.pending
+	d.pending = nil
+	d.unsent = append(d.unsent, pending...)
+
+	hooks := d.hooks()
+	for _, event := range pending {
+		for _, err := range hooks.RunPost(event) {
+			log.Warnf("%v", err)
+			if err := d.Log(HookFailedOption, event.Option, event.Engineer, err.Error()); err != nil {
+				log.Warnf("Failed to log hook failure: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jvzantvoort/scmt/logger"
+)
+
+// newHookTestData returns test data with a hooks directory holding the
+// given shell scripts
+func newHookTestData(t *testing.T, hooks map[string]string) *Data {
+	t.Helper()
+	d := newTestData(t)
+	d.Config.Hooksdir = filepath.Join(d.Config.Configdir, "hooks.d")
+	d.Config.HookTimeout = time.Minute
+	if err := os.MkdirAll(d.Config.Hooksdir, 0755); err != nil {
+		t.Fatalf("Failed to create hooks dir: %v", err)
+	}
+	for name, script := range hooks {
+		if err := os.WriteFile(filepath.Join(d.Config.Hooksdir, name), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+			t.Fatalf("Failed to write hook: %v", err)
+		}
+	}
+	return d
+}
+
+func TestData_PreChange_Veto(t *testing.T) {
+	d := newHookTestData(t, map[string]string{
+		"pre-10-freeze": `case "$SCMT_HOOK_OPTION:$SCMT_HOOK_NEW" in OWNER:*|ROLE_ADD:database) exit 1;; esac` + "\n",
+	})
+
+	if _, err := d.Set("TYPE", "server", "testuser", "test"); err != nil {
+		t.Fatalf("Expected TYPE to be allowed, got %v", err)
+	}
+	if changed, err := d.Set("OWNER", "Ops", "testuser", "test"); err == nil || changed {
+		t.Errorf("Expected OWNER to be vetoed, got %t, %v", changed, err)
+	}
+	if _, err := d.Get("OWNER"); err == nil {
+		t.Error("Expected a vetoed option not to be set")
+	}
+
+	// A vetoed role leaves every role unchanged
+	if _, err := d.AddRoleEntries([]Role{{Name: "web-server"}, {Name: "database"}}, "testuser", "test"); err == nil {
+		t.Error("Expected the database role to be vetoed")
+	}
+	if len(d.Roles) != 0 {
+		t.Errorf("Expected no roles after a veto, got %v", d.ListRoles())
+	}
+
+	logh, err := logger.New(d.Config.Logfile)
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	if vetoes := logh.Select(HookVetoOption); len(vetoes) != 2 {
+		t.Errorf("Expected 2 vetoes in the audit log, got %+v", vetoes)
+	}
+	if records := logh.Select("OWNER"); len(records) != 0 {
+		t.Errorf("Expected no change of OWNER in the audit log, got %+v", records)
+	}
+}
+
+func TestData_Import_Veto(t *testing.T) {
+	d := newHookTestData(t, map[string]string{
+		"pre-10-freeze": `[ "$SCMT_HOOK_OPTION" = "OWNER" ] && exit 1` + "\nexit 0\n",
+	})
+	d.Elements = []DataElement{
+		{Option: "TYPE", Value: DataElementValue{Value: "server"}},
+		{Option: "ZONE", Value: DataElementValue{Value: "a"}},
+	}
+
+	// AAA sorts before OWNER, so a veto of OWNER comes partway through
+	options := map[string]string{"AAA": "first", "OWNER": "Ops", "TYPE": "desktop"}
+	if _, err := d.Import(options, true, "testuser", "import"); err == nil {
+		t.Fatal("Expected the import to be vetoed")
+	}
+	if _, err := d.Get("AAA"); err == nil {
+		t.Error("Expected no option imported after a veto")
+	}
+	if value, _ := d.Get("TYPE"); value.Value != "server" {
+		t.Errorf("Expected TYPE unchanged after a veto, got %s", value.Value)
+	}
+	if _, err := d.Get("ZONE"); err != nil {
+		t.Error("Expected ZONE kept after a veto")
+	}
+	if len(d.pending) != 0 {
+		t.Errorf("Expected no pending changes after a veto, got %+v", d.pending)
+	}
+
+	logh, err := logger.New(d.Config.Logfile)
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	for _, option := range []string{"AAA", "TYPE", OptionRemoveOption} {
+		if records := logh.Select(option); len(records) != 0 {
+			t.Errorf("Expected no %s record after a veto, got %+v", option, records)
+		}
+	}
+}
+
+func TestData_PostHooks(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "hooks.out")
+	d := newHookTestData(t, map[string]string{
+		"10-record": `echo "$SCMT_HOOK_OPTION=$SCMT_HOOK_NEW" >> ` + out + "\n",
+		"20-fail":   "exit 1\n",
+	})
+
+	if _, err := d.Set("OWNER", "Ops", "testuser", "test"); err != nil {
+		t.Fatalf("Failed to set option: %v", err)
+	}
+	if _, err := d.AddRole("web-server", "testuser", "test"); err != nil {
+		t.Fatalf("Failed to add role: %v", err)
+	}
+
+	// Post hooks wait until the changes are saved
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Error("Expected no post hooks before saving")
+	}
+
+	if err := d.Save(); err != nil {
+		t.Fatalf("Failed to save data: %v", err)
+	}
+	content, _ := os.ReadFile(out)
+	if string(content) != "OWNER=Ops\nROLE_ADD=web-server\n" {
+		t.Errorf("Unexpected hook output %q", content)
+	}
+
+	// Failing hooks do not undo the change but are audited
+	if value, err := d.Get("OWNER"); err != nil || value.Value != "Ops" {
+		t.Errorf("Expected OWNER to stay set, got %v, %v", value, err)
+	}
+	logh, _ := logger.New(d.Config.Logfile)
+	if failures := logh.Select(HookFailedOption); len(failures) != 2 {
+		t.Errorf("Expected 2 hook failures in the audit log, got %+v", failures)
+	}
+
+	// Saving again runs no hooks for changes already committed
+	if err := d.Save(); err != nil {
+		t.Fatalf("Failed to save data: %v", err)
+	}
+	if again, _ := os.ReadFile(out); string(again) != string(content) {
+		t.Errorf("Expected no hooks without changes, got %q", again)
+	}
+}
@@ -0,0 +1,291 @@
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Import formats
+const (
+	FormatEnv  string = "env"
+	FormatJSON string = "json"
+	FormatYAML string = "yaml"
+	FormatINI  string = "ini"
+)
+
+// Actions of an import change
+const (
+	ImportAdded   string = "added"
+	ImportChanged string = "changed"
+	ImportRemoved string = "removed"
+)
+
+// ImportChange is a change an import makes to an option
+type ImportChange struct {
+	Option string `json:"option"`
+	Action string `json:"action"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+}
+
+// ImportFormat guesses the format of a file from its extension, KEY=VALUE
+// lines when the extension is not known
+func ImportFormat(file string) string {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		return FormatJSON
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".ini", ".cfg":
+		return FormatINI
+	default:
+		return FormatEnv
+	}
+}
+
+// ParseImport converts the content of a file in the given format to
+// options. Nested keys of JSON and YAML files and the sections of INI files
+// become prefixes joined by an underscore, e.g. DATABASE_PORT.
+func ParseImport(format string, content []byte) (map[string]string, error) {
+	switch format {
+	case FormatEnv:
+		return parseEnv(content)
+	case FormatINI:
+		return parseINI(content)
+	case FormatJSON:
+		var tree map[string]interface{}
+		if err := json.Unmarshal(content, &tree); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+		retv := map[string]string{}
+		return retv, flatten(retv, "", tree)
+	case FormatYAML:
+		var tree map[string]interface{}
+		if err := yaml.Unmarshal(content, &tree); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML: %w", err)
+		}
+		retv := map[string]string{}
+		return retv, flatten(retv, "", tree)
+	}
+	return nil, fmt.Errorf("unsupported import format %q", format)
+}
+
+// parseEnv parses KEY=VALUE lines, as written in .env files. The roles
+// written by Export in RolesVariable are not an option and are skipped.
+func parseEnv(content []byte) (map[string]string, error) {
+	retv := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineno)
+		}
+		if key == RolesVariable {
+			continue
+		}
+		retv[key] = unquote(strings.TrimSpace(value))
+	}
+	return retv, scanner.Err()
+}
+
+// parseINI parses key = value lines, prefixing keys with their section
+func parseINI(content []byte) (map[string]string, error) {
+	retv := map[string]string{}
+	prefix := ""
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			prefix = strings.TrimSpace(line[1:len(line)-1]) + "_"
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			key, value, found = strings.Cut(line, ":")
+		}
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("line %d: expected key = value", lineno)
+		}
+		retv[prefix+key] = unquote(strings.TrimSpace(value))
+	}
+	return retv, scanner.Err()
+}
+
+// flatten stores the scalar values of a tree under their joined keys, lists
+// are stored comma separated
+func flatten(retv map[string]string, prefix string, tree map[string]interface{}) error {
+	for key, value := range tree {
+		switch value := value.(type) {
+		case map[string]interface{}:
+			if err := flatten(retv, prefix+key+"_", value); err != nil {
+				return err
+			}
+		case []interface{}:
+			items := []string{}
+			for _, item := range value {
+				scalar, err := scalarString(item)
+				if err != nil {
+					return fmt.Errorf("%s%s: %w", prefix, key, err)
+				}
+				items = append(items, scalar)
+			}
+			retv[prefix+key] = strings.Join(items, ",")
+		default:
+			scalar, err := scalarString(value)
+			if err != nil {
+				return fmt.Errorf("%s%s: %w", prefix, key, err)
+			}
+			retv[prefix+key] = scalar
+		}
+	}
+	return nil
+}
+
+// scalarString formats a scalar value as a string
+func scalarString(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case int:
+		return strconv.Itoa(value), nil
+	case int64:
+		return strconv.FormatInt(value, 10), nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("unsupported value %v", value)
+}
+
+// unquote removes matching single or double quotes around a value. Double
+// quoted values use Go escapes, or the escapes of env files written by
+// scmt export.
+func unquote(value string) string {
+	if len(value) >= 2 {
+		if value[0] == '"' && value[len(value)-1] == '"' {
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				return unquoted
+			}
+			return envUnescape(value[1 : len(value)-1])
+		}
+		if value[0] == '\'' && value[len(value)-1] == '\'' {
+			return value[1 : len(value)-1]
+		}
+	}
+	return value
+}
+
+// envUnescape resolves the backslash escapes of double quoted env file
+// values, \n is a newline and other escaped characters stand for themselves
+func envUnescape(value string) string {
+	var retv strings.Builder
+	escaped := false
+	for _, char := range value {
+		switch {
+		case escaped && char == 'n':
+			retv.WriteRune('\n')
+		case escaped:
+			retv.WriteRune(char)
+		case char == '\\':
+			escaped = true
+			continue
+		default:
+			retv.WriteRune(char)
+		}
+		escaped = false
+	}
+	return retv.String()
+}
+
+// ImportChanges returns the changes importing the options makes, sorted by
+// option. With replace, options missing from the import are removed.
+func (d Data) ImportChanges(options map[string]string, replace bool) []ImportChange {
+	retv := []ImportChange{}
+	current := map[string]string{}
+	for _, element := range d.Elements {
+		current[element.Option] = element.Value.Value
+	}
+
+	for option, value := range options {
+		old, found := current[option]
+		if !found {
+			retv = append(retv, ImportChange{Option: option, Action: ImportAdded, New: value})
+		} else if old != value {
+			retv = append(retv, ImportChange{Option: option, Action: ImportChanged, Old: old, New: value})
+		}
+	}
+
+	if replace {
+		for option, old := range current {
+			if _, found := options[option]; !found {
+				retv = append(retv, ImportChange{Option: option, Action: ImportRemoved, Old: old})
+			}
+		}
+	}
+
+	sort.Slice(retv, func(i, j int) bool { return retv[i].Option < retv[j].Option })
+	return retv
+}
+
+// Import applies the changes of ImportChanges, recording every change with
+// the same engineer and message. The pre- hooks run for every change first,
+// so a veto leaves every option unchanged.
+func (d *Data) Import(options map[string]string, replace bool, engineer, message string) ([]ImportChange, error) {
+	changes := d.ImportChanges(options, replace)
+	if err := d.preImportChanges(changes, engineer, message); err != nil {
+		return nil, err
+	}
+
+	for _, change := range changes {
+		if change.Action == ImportRemoved {
+			d.unset(change.Option, engineer, message)
+			continue
+		}
+		d.set(change.Option, change.New, engineer, message)
+	}
+	return changes, nil
+}
+
+// preImportChanges runs the pre- hooks for the planned import changes
+func (d *Data) preImportChanges(changes []ImportChange, engineer, message string) error {
+	for _, change := range changes {
+		var err error
+		if change.Action == ImportRemoved {
+			err = d.PreChange(OptionRemoveOption, removedValue(change.Option, change.Old), "", engineer, message)
+		} else {
+			err = d.PreChange(change.Option, change.Old, change.New, engineer, message)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/jvzantvoort/scmt/logger"
+)
+
+func TestImportFormat(t *testing.T) {
+	tests := map[string]string{
+		"server.json":  FormatJSON,
+		"server.YAML":  FormatYAML,
+		"server.yml":   FormatYAML,
+		"server.ini":   FormatINI,
+		"server.env":   FormatEnv,
+		".env":         FormatEnv,
+		"puppet-facts": FormatEnv,
+	}
+	for file, expected := range tests {
+		if got := ImportFormat(file); got != expected {
+			t.Errorf("ImportFormat(%q): expected %s, got %s", file, expected, got)
+		}
+	}
+}
+
+func TestParseImport(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		content  string
+		expected map[string]string
+	}{
+		{
+			name:   "env",
+			format: FormatEnv,
+			content: `# comment
+OWNER="DevOps Team"
+export TIMEZONE=UTC
+QUOTED='it''s'
+EMPTY=
+`,
+			expected: map[string]string{"OWNER": "DevOps Team", "TIMEZONE": "UTC", "QUOTED": "it''s", "EMPTY": ""},
+		},
+		{
+			name:     "json",
+			format:   FormatJSON,
+			content:  `{"OWNER": "ops", "database": {"port": 5432, "replica": true}, "dns": ["a", "b"]}`,
+			expected: map[string]string{"OWNER": "ops", "database_port": "5432", "database_replica": "true", "dns": "a,b"},
+		},
+		{
+			name:   "yaml",
+			format: FormatYAML,
+			content: `OWNER: ops
+database:
+  port: 5432
+  ratio: 0.5
+dns:
+  - a
+  - b
+`,
+			expected: map[string]string{"OWNER": "ops", "database_port": "5432", "database_ratio": "0.5", "dns": "a,b"},
+		},
+		{
+			name:   "ini",
+			format: FormatINI,
+			content: `; comment
+OWNER = ops
+[database]
+port = 5432
+host: db01
+`,
+			expected: map[string]string{"OWNER": "ops", "database_port": "5432", "database_host": "db01"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseImport(tt.format, []byte(tt.content))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			if len(got) != len(tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+			for key, value := range tt.expected {
+				if got[key] != value {
+					t.Errorf("Expected %s=%q, got %q", key, value, got[key])
+				}
+			}
+		})
+	}
+
+	if _, err := ParseImport(FormatEnv, []byte("NOVALUE\n")); err == nil {
+		t.Error("Expected error for a line without =")
+	}
+	if _, err := ParseImport(FormatJSON, []byte("[1, 2]")); err == nil {
+		t.Error("Expected error for a JSON list")
+	}
+	if _, err := ParseImport("xml", []byte("")); err == nil {
+		t.Error("Expected error for an unsupported format")
+	}
+}
+
+func TestData_Import(t *testing.T) {
+	d := newTestData(t)
+	if _, err := d.Set("OWNER", "Mad House", "testuser", "test"); err != nil {
+		t.Fatalf("Failed to set option: %v", err)
+	}
+	if _, err := d.Set("TIMEZONE", "UTC", "testuser", "test"); err != nil {
+		t.Fatalf("Failed to set option: %v", err)
+	}
+
+	options := map[string]string{"OWNER": "DevOps", "TIMEZONE": "UTC", "DB_PORT": "5432"}
+
+	changes := d.ImportChanges(options, true)
+	expected := []ImportChange{
+		{Option: "DB_PORT", Action: ImportAdded, New: "5432"},
+		{Option: "OWNER", Action: ImportChanged, Old: "Mad House", New: "DevOps"},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], changes[i])
+		}
+	}
+
+	// Replace removes what is not imported
+	changes, err := d.Import(map[string]string{"OWNER": "DevOps"}, true, "importer", "Import from facts")
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if len(changes) != 2 || changes[1].Action != ImportRemoved {
+		t.Errorf("Expected a change and a removal, got %v", changes)
+	}
+	if _, err := d.Get("TIMEZONE"); err == nil {
+		t.Error("Expected TIMEZONE to be removed")
+	}
+	value, _ := d.Get("OWNER")
+	if value.Value != "DevOps" || value.Engineer != "importer" || value.Message != "Import from facts" {
+		t.Errorf("Expected the import engineer and message, got %+v", value)
+	}
+
+	// Removals are audited with the removed value, unlike a change to ""
+	logh, err := logger.New(d.Config.Logfile)
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	if records := logh.Select("TIMEZONE"); len(records) != 1 || records[0].Value != "UTC" {
+		t.Errorf("Expected only the TIMEZONE change in its records, got %+v", records)
+	}
+	removals := logh.Select(OptionRemoveOption)
+	if len(removals) != 1 || removals[0].Value != "TIMEZONE=UTC" || removals[0].Engineer != "importer" {
+		t.Errorf("Expected the removal of TIMEZONE=UTC, got %+v", removals)
+	}
+}
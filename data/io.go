@@ -47,10 +47,15 @@ func (d Data) Dumper(outputtype string, writer io.Writer) error {
 	utils.LogStart()
 	defer utils.LogEnd()
 
+	values, err := d.Effective()
+	if err != nil {
+		return err
+	}
+
 	mdata := map[string]string{}
-	for indx, element := range d.Elements {
-		utils.LogVariable(indx, element)
-		mdata[element.Option] = element.Value.Value
+	for indx, value := range values {
+		utils.LogVariable(indx, value)
+		mdata[value.Option] = value.Value
 	}
 
 	if outputtype == "json" {
@@ -66,13 +71,17 @@ func (d Data) Dumper(outputtype string, writer io.Writer) error {
 		table.Header([]string{"Name", "Value", "Engineer", "Changed", "Message"})
 		tabledata := [][]string{}
 
-		for _, element := range d.Elements {
+		for _, value := range values {
+			changed := ""
+			if value.Changed != nil {
+				changed = value.Changed.Format("2006-01-02 15:04")
+			}
 			cols := []string{}
-			cols = append(cols, element.Option)
-			cols = append(cols, element.Value.Value)
-			cols = append(cols, element.Value.Engineer)
-			cols = append(cols, element.Value.Changed.Format("2006-01-02 15:04"))
-			cols = append(cols, element.Value.Message)
+			cols = append(cols, value.Option)
+			cols = append(cols, value.Value)
+			cols = append(cols, value.Engineer)
+			cols = append(cols, changed)
+			cols = append(cols, value.Message)
 			tabledata = append(tabledata, cols)
 		}
 		if err := table.Bulk(tabledata); err != nil {
@@ -85,6 +94,41 @@ func (d Data) Dumper(outputtype string, writer io.Writer) error {
 	return nil
 }
 
+// Explain writes the effective configuration with the source of each value
+func (d Data) Explain(outputtype string, writer io.Writer) error {
+	utils.LogStart()
+	defer utils.LogEnd()
+
+	values, err := d.Effective()
+	if err != nil {
+		return err
+	}
+
+	if outputtype == "json" {
+		content, err := json.MarshalIndent(values, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(writer, "%s\n", string(content))
+		return err
+	}
+
+	table := tablewriter.NewWriter(writer)
+	table.Header([]string{"Name", "Value", "Source"})
+	tabledata := [][]string{}
+	for _, value := range values {
+		source := value.Source
+		if value.Role != "" {
+			source = fmt.Sprintf("%s %s", value.Source, value.Role)
+		}
+		tabledata = append(tabledata, []string{value.Option, value.Value, source})
+	}
+	if err := table.Bulk(tabledata); err != nil {
+		return err
+	}
+	return table.Render()
+}
+
 // Read session content from a [io.Reader] object.
 func (data *Data) Reader(reader io.Reader) error {
 	utils.LogStart()
@@ -121,8 +165,9 @@ func (data *Data) Open() error {
 
 }
 
-// Write session configuration to a projectfile
-func (data Data) Save() error {
+// Write session configuration to a projectfile, then run the post hooks of
+// the changes it commits
+func (data *Data) Save() error {
 	utils.LogStart()
 	defer utils.LogEnd()
 
@@ -140,6 +185,30 @@ func (data Data) Save() error {
 		utils.Errorf("cannot open project file for writing: %s", err)
 		return err
 	}
-	defer filehandle.Close()
-	return data.Writer(filehandle)
+	if err := data.Writer(filehandle); err != nil {
+		filehandle.Close()
+		return err
+	}
+	if err := filehandle.Close(); err != nil {
+		return err
+	}
+
+	data.RunPostHooks()
+	return nil
+}
+
+// Lock serializes changes to the data file between processes: every command
+// that reads, changes and saves the data holds the lock from Open to Save.
+// The returned function releases the lock and then notifies the webhooks of
+// the saved changes, so slow webhooks never hold up other commands.
+func (data *Data) Lock() (func(), error) {
+	configfile, _ := data.ConfigFile()
+	unlock, err := utils.LockFile(configfile + ".lock")
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		unlock()
+		data.SendNotifications()
+	}, nil
 }
@@ -117,9 +117,13 @@ func TestData_Writer(t *testing.T) {
 	if !ok || len(roles) != 1 {
 		t.Errorf("Expected 1 role in JSON output, got %v", roles)
 	}
-	if roles[0] != "web-server" {
+	role, ok := roles[0].(map[string]interface{})
+	if !ok || role["name"] != "web-server" {
 		t.Errorf("Expected role 'web-server', got %v", roles[0])
 	}
+	if role["engineer"] != "testuser" || role["message"] != "test role" {
+		t.Errorf("Expected role engineer and message to be recorded, got %v", roles[0])
+	}
 }
 
 func TestData_Dumper_JSON(t *testing.T) {
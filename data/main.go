@@ -2,10 +2,12 @@ package data
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jvzantvoort/scmt/config"
 	"github.com/jvzantvoort/scmt/logger"
+	"github.com/jvzantvoort/scmt/notify"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -37,7 +39,12 @@ type Data struct {
 	Config         config.Config `json:"-"`
 	logger.Records `json:"-"`    // Embedded logger records for change tracking
 	Elements       []DataElement `json:"elements"`
-	Roles          []string      `json:"roles"`
+	Roles          []Role        `json:"roles"`
+
+	// Changes waiting for the post hooks until they are saved
+	pending []notify.Event
+	// Saved changes waiting for the webhooks until the lock is released
+	unsent []notify.Event
 }
 
 func (d Data) Get(option string) (*DataElementValue, error) {
@@ -62,7 +69,64 @@ func (d Data) Log(option, value, engineer, message string) error {
 	return logInstance.Save()
 }
 
+// LogChange records a change in the audit log like Log and queues it for
+// the post hooks, which run once the change is committed by Save or
+// RunPostHooks, and then for the webhooks, which are notified by
+// SendNotifications.
+func (d *Data) LogChange(option, old, value, engineer, message string) error {
+	if err := d.Log(option, value, engineer, message); err != nil {
+		return err
+	}
+	d.pending = append(d.pending, notify.NewEvent(option, old, value, engineer, message))
+	return nil
+}
+
+// LogRemoval records the removal of old like LogChange. The audit record
+// holds the removed value, so it cannot be mistaken for a change to "".
+func (d *Data) LogRemoval(option, old, engineer, message string) error {
+	if err := d.Log(option, old, engineer, message); err != nil {
+		return err
+	}
+	d.pending = append(d.pending, notify.NewEvent(option, old, "", engineer, message))
+	return nil
+}
+
+// SendNotifications notifies the webhooks of the committed changes. The
+// function returned by Lock calls it once the lock is released, commands
+// changing files without the lock call it themselves. Every webhook gets the
+// configured retries, notifications still failing then are spooled for
+// "scmt notify flush" and only warned about, they never fail the change.
+func (d *Data) SendNotifications() {
+	unsent := d.unsent
+	d.unsent = nil
+	if len(unsent) == 0 {
+		return
+	}
+
+	notifier, err := notify.New(d.Config.Notifyfile, d.Config.Spooldir)
+	if err != nil {
+		log.Warnf("Failed to notify change: %v", err)
+		return
+	}
+	for _, event := range unsent {
+		if err := notifier.Send(event); err != nil {
+			log.Warnf("Failed to notify change: %v", err)
+		}
+	}
+}
+
+// Set sets an option. The pre- hooks may veto a change of the value.
 func (d *Data) Set(option, value, engineer, message string) (bool, error) {
+	if current, err := d.Get(option); err != nil || current.Value != value {
+		if err := d.PreChange(option, current.Value, value, engineer, message); err != nil {
+			return false, err
+		}
+	}
+	return d.set(option, value, engineer, message), nil
+}
+
+// set sets an option like Set, once the pre- hooks accepted the change
+func (d *Data) set(option, value, engineer, message string) bool {
 	log.Debugf("Set %s to %s, start", option, value)
 	defer log.Debugf("Set %s to %s, end", option, value)
 	log.Debugf("   By:     %s", engineer)
@@ -80,7 +144,7 @@ func (d *Data) Set(option, value, engineer, message string) (bool, error) {
 				log.Debugf("value is unchanged")
 			} else {
 				log.Debugf("value changed from %s to %s", orgval, value)
-				if err := d.Log(option, value, engineer, message); err != nil {
+				if err := d.LogChange(option, orgval, value, engineer, message); err != nil {
 					log.Warnf("Failed to log change: %v", err)
 				}
 				d.Elements[i].Value.Value = value
@@ -95,21 +159,57 @@ func (d *Data) Set(option, value, engineer, message string) (bool, error) {
 
 	// add if not found
 	if !found {
-
 		row := DataElement{}
 		row.Option = option
 		row.Value.Value = value
 		row.Value.Engineer = engineer
 		row.Value.Changed = now
 		row.Value.Message = message
-		if err := d.Log(option, value, engineer, message); err != nil {
+		if err := d.LogChange(option, "", value, engineer, message); err != nil {
 			log.Warnf("Failed to log change: %v", err)
 		}
 		d.Elements = append(d.Elements, row)
 		changed = true
 	}
 
-	return changed, nil
+	return changed
+}
+
+// OptionRemoveOption is the audit log option of removed options, the value
+// of its records is KEY=VALUE of the removed option
+const OptionRemoveOption string = "OPTION_REMOVE"
+
+// Unset removes an option. The pre- hooks may veto the removal.
+func (d *Data) Unset(option, engineer, message string) (bool, error) {
+	current, err := d.Get(option)
+	if err != nil {
+		return false, err
+	}
+	if err := d.PreChange(OptionRemoveOption, removedValue(option, current.Value), "", engineer, message); err != nil {
+		return false, err
+	}
+	d.unset(option, engineer, message)
+	return true, nil
+}
+
+// unset removes an option like Unset, once the pre- hooks accepted the
+// removal
+func (d *Data) unset(option, engineer, message string) {
+	for i, element := range d.Elements {
+		if element.Option == option {
+			removed := removedValue(option, element.Value.Value)
+			d.Elements = append(d.Elements[:i], d.Elements[i+1:]...)
+			if err := d.LogRemoval(OptionRemoveOption, removed, engineer, message); err != nil {
+				log.Warnf("Failed to log change: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// removedValue is the audit log value of the removal of an option
+func removedValue(option, value string) string {
+	return fmt.Sprintf("%s=%s", option, value)
 }
 
 func (d *Data) SafeSet(option, value, engineer, message string) error {
@@ -129,58 +229,51 @@ func (d *Data) Init(engineer string) error {
 	log.Debugf("Init data structure, start")
 	defer log.Debugf("Init data structure, end")
 
-	for option, val := range defaultData {
-		_, err := d.Set(option, val, engineer, "Initialize")
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+	// The defaults are imported, so a veto leaves every option unchanged
+	_, err := d.Import(defaultData, false, engineer, "Initialize")
+	return err
 }
 
 // AddRole adds a role to the roles list if it doesn't already exist
 func (d *Data) AddRole(role, engineer, message string) (bool, error) {
-	// Check if role already exists
-	for _, r := range d.Roles {
-		if r == role {
-			return false, nil // Role already exists, no change
-		}
-	}
-
-	// Add the role
-	d.Roles = append(d.Roles, role)
-	if err := d.Log("ROLE_ADD", role, engineer, message); err != nil {
-		log.Warnf("Failed to log role addition: %v", err)
-	}
-	return true, nil
+	return d.AddRoleEntry(Role{Name: role}, engineer, message)
 }
 
-// RemoveRole removes a role from the roles list
+// RemoveRole removes a role from the roles list, refusing to remove a role
+// another assigned role requires according to the role catalog
 func (d *Data) RemoveRole(role, engineer, message string) (bool, error) {
-	for i, r := range d.Roles {
-		if r == role {
-			// Remove the role by slicing
-			d.Roles = append(d.Roles[:i], d.Roles[i+1:]...)
-			if err := d.Log("ROLE_REMOVE", role, engineer, message); err != nil {
-				log.Warnf("Failed to log role removal: %v", err)
-			}
-			return true, nil
+	catalog, err := d.Catalog()
+	if err != nil {
+		return false, err
+	}
+	if dependents := catalog.RequiredBy(role, d.ListRoles()); len(dependents) > 0 {
+		return false, fmt.Errorf("role %s is required by %s", role, strings.Join(dependents, ", "))
+	}
+	if d.HasRole(role) {
+		if err := d.PreChange("ROLE_REMOVE", role, "", engineer, message); err != nil {
+			return false, err
 		}
 	}
-	return false, fmt.Errorf("role %s not found", role)
+
+	if !d.removeRole(role, engineer, message) {
+		return false, fmt.Errorf("role %s not found", role)
+	}
+	return true, nil
 }
 
-// ListRoles returns a copy of the roles list
+// ListRoles returns a copy of the role names
 func (d *Data) ListRoles() []string {
 	roles := make([]string, len(d.Roles))
-	copy(roles, d.Roles)
+	for i, r := range d.Roles {
+		roles[i] = r.Name
+	}
 	return roles
 }
 
 // HasRole checks if a role exists in the roles list
 func (d *Data) HasRole(role string) bool {
 	for _, r := range d.Roles {
-		if r == role {
+		if r.Name == role {
 			return true
 		}
 	}
@@ -191,7 +284,7 @@ func New(cfg config.Config) (*Data, error) {
 	retv := &Data{}
 	retv.Config = cfg
 	retv.Elements = make([]DataElement, 0)
-	retv.Roles = make([]string, 0)
+	retv.Roles = make([]Role, 0)
 	return retv, nil
 
 }
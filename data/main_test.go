@@ -1,11 +1,17 @@
 package data
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/jvzantvoort/scmt/config"
+	"github.com/jvzantvoort/scmt/logger"
+	"github.com/jvzantvoort/scmt/notify"
 )
 
 func TestData_AddRole(t *testing.T) {
@@ -30,7 +36,7 @@ func TestData_AddRole(t *testing.T) {
 	if !changed {
 		t.Error("Expected AddRole to return true for new role")
 	}
-	if len(d.Roles) != 1 || d.Roles[0] != "web-server" {
+	if len(d.Roles) != 1 || d.Roles[0].Name != "web-server" {
 		t.Errorf("Expected roles to contain 'web-server', got %v", d.Roles)
 	}
 
@@ -73,7 +79,7 @@ func TestData_RemoveRole(t *testing.T) {
 	}
 
 	// Add some roles first
-	d.Roles = []string{"web-server", "database", "cache"}
+	d.Roles = []Role{{Name: "web-server"}, {Name: "database"}, {Name: "cache"}}
 
 	// Test removing existing role
 	changed, err := d.RemoveRole("database", "testuser", "test message")
@@ -87,11 +93,20 @@ func TestData_RemoveRole(t *testing.T) {
 		t.Errorf("Expected 2 roles after removal, got %d", len(d.Roles))
 	}
 	for _, role := range d.Roles {
-		if role == "database" {
+		if role.Name == "database" {
 			t.Error("Role 'database' should have been removed")
 		}
 	}
 
+	// The audit record holds the removed role
+	logh, err := logger.New(cfg.Logfile)
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	if records := logh.Select("ROLE_REMOVE"); len(records) != 1 || records[0].Value != "database" {
+		t.Errorf("Expected a ROLE_REMOVE record of database, got %+v", records)
+	}
+
 	// Test removing non-existent role
 	changed, err = d.RemoveRole("nonexistent", "testuser", "test message")
 	if err == nil {
@@ -112,7 +127,7 @@ func TestData_RemoveRole(t *testing.T) {
 	if !changed {
 		t.Error("Expected RemoveRole to return true")
 	}
-	if len(d.Roles) != 1 || d.Roles[0] != "cache" {
+	if len(d.Roles) != 1 || d.Roles[0].Name != "cache" {
 		t.Errorf("Expected only 'cache' role remaining, got %v", d.Roles)
 	}
 }
@@ -137,7 +152,7 @@ func TestData_ListRoles(t *testing.T) {
 	}
 
 	// Add some roles
-	d.Roles = []string{"web-server", "database"}
+	d.Roles = []Role{{Name: "web-server"}, {Name: "database"}}
 
 	// Test listing roles
 	roles = d.ListRoles()
@@ -147,7 +162,7 @@ func TestData_ListRoles(t *testing.T) {
 
 	// Verify it's a copy (modifying returned slice shouldn't affect original)
 	roles[0] = "modified"
-	if d.Roles[0] == "modified" {
+	if d.Roles[0].Name == "modified" {
 		t.Error("ListRoles should return a copy, not reference to original slice")
 	}
 }
@@ -171,7 +186,7 @@ func TestData_HasRole(t *testing.T) {
 	}
 
 	// Add some roles
-	d.Roles = []string{"web-server", "database"}
+	d.Roles = []Role{{Name: "web-server"}, {Name: "database"}}
 
 	// Test existing roles
 	if !d.HasRole("web-server") {
@@ -406,3 +421,107 @@ func TestNew(t *testing.T) {
 		t.Error("Expected Roles slice to be initialized")
 	}
 }
+
+func TestData_LogChange_Notify(t *testing.T) {
+	var mutex sync.Mutex
+	events := []notify.Event{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event notify.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		events = append(events, event)
+	}))
+	defer server.Close()
+
+	d := newTestData(t)
+	d.Config.Notifyfile = filepath.Join(d.Config.Configdir, "notify.json")
+	d.Config.Spooldir = filepath.Join(d.Config.Configdir, "spool")
+	content := `{"webhooks": [{"url": "` + server.URL + `"}]}`
+	if err := os.WriteFile(d.Config.Notifyfile, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write notifier config: %v", err)
+	}
+
+	unlock, err := d.Lock()
+	if err != nil {
+		t.Fatalf("Failed to lock data: %v", err)
+	}
+	if _, err := d.Set("OWNER", "Mad House", "testuser", "initial"); err != nil {
+		t.Fatalf("Failed to set option: %v", err)
+	}
+	if _, err := d.Set("OWNER", "Ops", "testuser", "handover"); err != nil {
+		t.Fatalf("Failed to set option: %v", err)
+	}
+	// Unchanged values are not notified
+	if _, err := d.Set("OWNER", "Ops", "testuser", "again"); err != nil {
+		t.Fatalf("Failed to set option: %v", err)
+	}
+	if _, err := d.AddRole("web-server", "testuser", "deploy"); err != nil {
+		t.Fatalf("Failed to add role: %v", err)
+	}
+	if _, err := d.Unset("OWNER", "testuser", "cleanup"); err != nil {
+		t.Fatalf("Failed to unset option: %v", err)
+	}
+
+	// The webhooks are notified of saved changes once the lock is released
+	if err := d.Save(); err != nil {
+		t.Fatalf("Failed to save data: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected no events while the lock is held, got %+v", events)
+	}
+	unlock()
+
+	expected := []notify.Event{
+		{Option: "OWNER", Old: "", New: "Mad House", Message: "initial"},
+		{Option: "OWNER", Old: "Mad House", New: "Ops", Message: "handover"},
+		{Option: "ROLE_ADD", Old: "", New: "web-server", Message: "deploy"},
+		{Option: "OPTION_REMOVE", Old: "OWNER=Ops", New: "", Message: "cleanup"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %+v", len(expected), events)
+	}
+	for i, event := range events {
+		if event.Option != expected[i].Option || event.Old != expected[i].Old || event.New != expected[i].New || event.Message != expected[i].Message || event.Engineer != "testuser" {
+			t.Errorf("Event %d: expected %+v, got %+v", i, expected[i], event)
+		}
+	}
+}
+
+func TestData_SendNotifications_Spool(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	d := newTestData(t)
+	d.Config.Notifyfile = filepath.Join(d.Config.Configdir, "notify.json")
+	d.Config.Spooldir = filepath.Join(d.Config.Configdir, "spool")
+	content := `{"webhooks": [{"url": "` + server.URL + `"}], "retries": 2, "retry_delay": "1ms"}`
+	if err := os.WriteFile(d.Config.Notifyfile, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write notifier config: %v", err)
+	}
+
+	if _, err := d.Set("OWNER", "Ops", "testuser", "handover"); err != nil {
+		t.Fatalf("Failed to set option: %v", err)
+	}
+	d.RunPostHooks()
+	d.SendNotifications()
+
+	// A failed notification is spooled once the retries are used up
+	if attempts != 3 {
+		t.Errorf("Expected an attempt and 2 retries, got %d", attempts)
+	}
+	notifier, err := notify.New(d.Config.Notifyfile, d.Config.Spooldir)
+	if err != nil {
+		t.Fatalf("Failed to create notifier: %v", err)
+	}
+	if spooled, _ := notifier.Spooled(); len(spooled) != 1 {
+		t.Errorf("Expected 1 spooled notification, got %v", spooled)
+	}
+}
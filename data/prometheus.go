@@ -0,0 +1,122 @@
+package data
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jvzantvoort/scmt/logger"
+	"github.com/jvzantvoort/scmt/utils"
+)
+
+// FormatPrometheus is the format of textfile collector files, written with
+// --prometheus instead of being one of the ExportFormats
+const FormatPrometheus string = "prometheus"
+
+// invalidLabel matches the characters not allowed in Prometheus label names
+var invalidLabel = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// Prometheus writes the metrics for the node_exporter textfile collector:
+// scmt_info labelled with the given options, a scmt_role per role, the time
+// of the last change and the number of audit records.
+func (d Data) Prometheus(labels []string, writer io.Writer) error {
+	utils.LogStart()
+	defer utils.LogEnd()
+
+	config, err := d.EffectiveMap()
+	if err != nil {
+		return err
+	}
+
+	records, err := logger.New(d.Config.Logfile)
+	if err != nil {
+		return err
+	}
+	if err := records.Open(); err != nil {
+		return fmt.Errorf("failed to read the audit log: %w", err)
+	}
+
+	var lastChange time.Time
+	for _, element := range d.Elements {
+		if element.Value.Changed.After(lastChange) {
+			lastChange = element.Value.Changed
+		}
+	}
+	for _, role := range d.Roles {
+		if role.Added.After(lastChange) {
+			lastChange = role.Added
+		}
+	}
+
+	// Duplicate labels make node_exporter reject the whole file
+	pairs := []string{}
+	seen := map[string]string{}
+	for _, option := range labels {
+		name := labelName(option)
+		if strings.HasPrefix(name, "__") {
+			return fmt.Errorf("label %s of option %s is reserved by Prometheus", name, option)
+		}
+		if other, found := seen[name]; found {
+			return fmt.Errorf("options %s and %s both become label %s", other, option, name)
+		}
+		value, found := config[option]
+		if !found {
+			return fmt.Errorf("option %s of label %s not found", option, name)
+		}
+		seen[name] = option
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, labelValue(value)))
+	}
+	sort.Strings(pairs)
+	info := "scmt_info 1"
+	if len(pairs) > 0 {
+		info = fmt.Sprintf("scmt_info{%s} 1", strings.Join(pairs, ","))
+	}
+
+	lines := []string{
+		"# HELP scmt_info Configuration of the server kept by scmt.",
+		"# TYPE scmt_info gauge",
+		info,
+		"# HELP scmt_role Roles assigned to the server.",
+		"# TYPE scmt_role gauge",
+	}
+	for _, role := range d.ListRoles() {
+		lines = append(lines, fmt.Sprintf("scmt_role{role=%s} 1", labelValue(role)))
+	}
+	lines = append(lines,
+		"# HELP scmt_last_change_timestamp_seconds Time of the last change of the configuration or roles.",
+		"# TYPE scmt_last_change_timestamp_seconds gauge",
+		fmt.Sprintf("scmt_last_change_timestamp_seconds %d", unixSeconds(lastChange)),
+		"# HELP scmt_audit_records Number of records in the scmt audit log.",
+		"# TYPE scmt_audit_records gauge",
+		fmt.Sprintf("scmt_audit_records %d", len(records.Records)),
+	)
+
+	_, err = fmt.Fprintln(writer, strings.Join(lines, "\n"))
+	return err
+}
+
+// labelName turns an option into a valid Prometheus label name
+func labelName(option string) string {
+	name := strings.ToLower(invalidLabel.ReplaceAllString(option, "_"))
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// labelValue quotes a Prometheus label value
+func labelValue(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+// unixSeconds returns the Unix time, 0 for the zero time
+func unixSeconds(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
@@ -0,0 +1,92 @@
+package data
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestData_Prometheus(t *testing.T) {
+	d := newTestData(t)
+	if _, err := d.Set("TYPE", "server", "testuser", "test"); err != nil {
+		t.Fatalf("Failed to set option: %v", err)
+	}
+	if _, err := d.Set("NOTE", "say \"hi\"\\n", "testuser", "test"); err != nil {
+		t.Fatalf("Failed to set option: %v", err)
+	}
+	if _, err := d.Set("my.key", "", "testuser", "test"); err != nil {
+		t.Fatalf("Failed to set option: %v", err)
+	}
+	if _, err := d.AddRole("web-server", "testuser", "test"); err != nil {
+		t.Fatalf("Failed to add role: %v", err)
+	}
+
+	// The latest change is the role
+	d.Elements[0].Value.Changed = time.Unix(1700000000, 0).UTC()
+	d.Elements[1].Value.Changed = time.Unix(1700000100, 0).UTC()
+	d.Elements[2].Value.Changed = time.Unix(1700000150, 0).UTC()
+	d.Roles[0].Added = time.Unix(1700000200, 0).UTC()
+
+	var buf bytes.Buffer
+	if err := d.Prometheus([]string{"TYPE", "NOTE", "my.key"}, &buf); err != nil {
+		t.Fatalf("Failed to write metrics: %v", err)
+	}
+
+	// Set and AddRole wrote four audit records
+	expected := []string{
+		"# TYPE scmt_info gauge\n",
+		`scmt_info{my_key="",note="say \"hi\"\\n",type="server"} 1` + "\n",
+		"# TYPE scmt_role gauge\n",
+		`scmt_role{role="web-server"} 1` + "\n",
+		"scmt_last_change_timestamp_seconds 1700000200\n",
+		"scmt_audit_records 4\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", line, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := d.Prometheus(nil, &buf); err != nil {
+		t.Fatalf("Failed to write metrics: %v", err)
+	}
+	if !strings.Contains(buf.String(), "\nscmt_info 1\n") {
+		t.Errorf("Expected scmt_info without labels, got:\n%s", buf.String())
+	}
+
+	// Duplicate, reserved and missing labels are refused
+	for _, option := range []string{"OWNER", "owner", "my_key", "__name__"} {
+		if _, err := d.Set(option, "x", "testuser", "test"); err != nil {
+			t.Fatalf("Failed to set option: %v", err)
+		}
+	}
+	tests := []struct {
+		labels   []string
+		expected string
+	}{
+		{[]string{"OWNER", "owner"}, "both become label owner"},
+		{[]string{"my.key", "my_key"}, "both become label my_key"},
+		{[]string{"__name__"}, "reserved"},
+		{[]string{"TYPE", "TYPO"}, "option TYPO of label typo not found"},
+	}
+	for _, test := range tests {
+		if err := d.Prometheus(test.labels, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("Expected error %q for labels %v, got %v", test.expected, test.labels, err)
+		}
+	}
+}
+
+func TestLabelName(t *testing.T) {
+	tests := map[string]string{
+		"OWNER":     "owner",
+		"web-port":  "web_port",
+		"1ST_VALUE": "_1st_value",
+	}
+	for option, expected := range tests {
+		if got := labelName(option); got != expected {
+			t.Errorf("labelName(%q): expected %q, got %q", option, expected, got)
+		}
+	}
+}
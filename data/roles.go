@@ -0,0 +1,330 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Role is a role assigned to the server together with who added it, why,
+// and optional parameters such as the port of a web-server role.
+type Role struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Engineer    string            `json:"engineer"`
+	Message     string            `json:"message"`
+	Added       time.Time         `json:"added"`
+	Parameters  map[string]string `json:"parameters,omitempty"`
+}
+
+// UnmarshalJSON accepts both the structured form and the plain role name
+// written by earlier versions of scmt.
+func (r *Role) UnmarshalJSON(content []byte) error {
+	var name string
+	if err := json.Unmarshal(content, &name); err == nil {
+		*r = Role{Name: name}
+		return nil
+	}
+
+	// plain has the fields of Role without this method
+	type plain Role
+	var retv plain
+	if err := json.Unmarshal(content, &retv); err != nil {
+		return err
+	}
+	*r = Role(retv)
+	return nil
+}
+
+// ParameterString returns the parameters as sorted key=value pairs
+func (r Role) ParameterString() string {
+	keys := make([]string, 0, len(r.Parameters))
+	for key := range r.Parameters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, r.Parameters[key]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// ParseParameters converts KEY=VALUE strings to a parameter map
+func ParseParameters(pairs []string) (map[string]string, error) {
+	retv := map[string]string{}
+	for _, pair := range pairs {
+		key, value, found := strings.Cut(pair, "=")
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid parameter %q, expected KEY=VALUE", pair)
+		}
+		retv[key] = value
+	}
+	return retv, nil
+}
+
+// GetRole returns a copy of the assigned role with the given name
+func (d Data) GetRole(name string) (*Role, error) {
+	for _, r := range d.Roles {
+		if r.Name == name {
+			retv := r
+			retv.Parameters = map[string]string{}
+			for key, value := range r.Parameters {
+				retv.Parameters[key] = value
+			}
+			return &retv, nil
+		}
+	}
+	return &Role{}, fmt.Errorf("role %s not found", name)
+}
+
+// AddRoleEntry adds a role with its description and parameters if it
+// doesn't already exist. The engineer, message and time of the change are
+// recorded on the role.
+//
+// The role catalog is enforced: roles the new role requires are added
+// first, conflicting roles are refused and in strict mode unknown roles are
+// refused.
+func (d *Data) AddRoleEntry(role Role, engineer, message string) (bool, error) {
+	added, err := d.AddRoleEntries([]Role{role}, engineer, message)
+	return len(added) > 0, err
+}
+
+// AddRoleEntries adds several roles at once and returns the names of the
+// roles that were added, including the roles they require. Nothing is added
+// when any of the roles is refused by the role catalog.
+func (d *Data) AddRoleEntries(roles []Role, engineer, message string) ([]string, error) {
+	catalog, err := d.Catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	added, err := d.planRoles(catalog, d.ListRoles(), roles)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.preRoleChanges(added, nil, roles, engineer, message); err != nil {
+		return nil, err
+	}
+	d.addRoles(catalog, added, roles, engineer, message)
+	return added, nil
+}
+
+// PlanRoles returns the names of the roles AddRoleEntries would add,
+// including the roles they require, without changing anything
+func (d *Data) PlanRoles(roles []Role) ([]string, error) {
+	catalog, err := d.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	return d.planRoles(catalog, d.ListRoles(), roles)
+}
+
+// SetRoles converges the assigned roles to the given roles: missing roles
+// are added, together with the roles they require, and roles not in the
+// list are removed. It returns the names of the added and removed roles.
+// Nothing changes when the catalog refuses the result.
+func (d *Data) SetRoles(names []string, engineer, message string) ([]string, []string, error) {
+	catalog, err := d.Catalog()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wanted := map[string]bool{}
+	roles := []Role{}
+	for _, name := range names {
+		if !wanted[name] {
+			wanted[name] = true
+			roles = append(roles, Role{Name: name})
+		}
+	}
+
+	// Roles required by a wanted role stay, even when not listed
+	for _, name := range names {
+		resolved, err := catalog.Resolve(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, required := range resolved {
+			wanted[required] = true
+		}
+	}
+
+	removed := []string{}
+	remaining := []string{}
+	for _, name := range d.ListRoles() {
+		if wanted[name] {
+			remaining = append(remaining, name)
+		} else {
+			removed = append(removed, name)
+		}
+	}
+
+	added, err := d.planRoles(catalog, remaining, roles)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	final := append(remaining, added...)
+	for _, name := range removed {
+		if dependents := catalog.RequiredBy(name, final); len(dependents) > 0 {
+			return nil, nil, fmt.Errorf("role %s is required by %s", name, strings.Join(dependents, ", "))
+		}
+	}
+
+	if err := d.preRoleChanges(added, removed, roles, engineer, message); err != nil {
+		return nil, nil, err
+	}
+	for _, name := range removed {
+		d.removeRole(name, engineer, message)
+	}
+	d.addRoles(catalog, added, roles, engineer, message)
+	return added, removed, nil
+}
+
+// planRoles returns the names of the roles to add to the assigned roles,
+// the roles they require first, and checks them against the catalog
+func (d *Data) planRoles(catalog *Catalog, assigned []string, roles []Role) ([]string, error) {
+	present := map[string]bool{}
+	for _, name := range assigned {
+		present[name] = true
+	}
+
+	retv := []string{}
+	for _, role := range roles {
+		names, err := catalog.Resolve(role.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range names {
+			if present[name] {
+				continue
+			}
+			if catalog.Strict && !catalog.Known(name) {
+				return nil, fmt.Errorf("role %s is not in the role catalog %s", name, catalog.Catalogfile)
+			}
+			for _, other := range append(assigned, retv...) {
+				if catalog.Conflicting(name, other) {
+					return nil, fmt.Errorf("role %s conflicts with role %s", name, other)
+				}
+			}
+			present[name] = true
+			retv = append(retv, name)
+		}
+	}
+	return retv, nil
+}
+
+// preRoleChanges runs the pre- hooks for the planned role changes, so a
+// veto leaves every role unchanged
+func (d *Data) preRoleChanges(added, removed []string, roles []Role, engineer, message string) error {
+	entries := map[string]Role{}
+	for _, role := range roles {
+		entries[role.Name] = role
+	}
+
+	for _, name := range removed {
+		if err := d.PreChange("ROLE_REMOVE", name, "", engineer, message); err != nil {
+			return err
+		}
+	}
+	for _, name := range added {
+		entry, found := entries[name]
+		if !found {
+			entry = Role{Name: name}
+		}
+		if err := d.PreChange("ROLE_ADD", "", entry.logValue(), engineer, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logValue is the value of the role in the audit log
+func (r Role) logValue() string {
+	if len(r.Parameters) > 0 {
+		return fmt.Sprintf("%s: %s", r.Name, r.ParameterString())
+	}
+	return r.Name
+}
+
+// addRoles adds the planned roles, using the given role entries for their
+// description and parameters and the catalog for the roles they require
+func (d *Data) addRoles(catalog *Catalog, names []string, roles []Role, engineer, message string) {
+	entries := map[string]Role{}
+	for _, role := range roles {
+		entries[role.Name] = role
+	}
+
+	for _, name := range names {
+		entry, found := entries[name]
+		if !found {
+			entry = Role{Name: name}
+		}
+		if entry.Description == "" {
+			entry.Description = catalog.Roles[name].Description
+		}
+		d.addRole(entry, engineer, message)
+	}
+}
+
+// addRole appends the role and logs the addition
+func (d *Data) addRole(role Role, engineer, message string) {
+	role.Engineer = engineer
+	role.Message = message
+	role.Added = time.Now().UTC()
+	d.Roles = append(d.Roles, role)
+
+	if err := d.LogChange("ROLE_ADD", "", role.logValue(), engineer, message); err != nil {
+		log.Warnf("Failed to log role addition: %v", err)
+	}
+}
+
+// removeRole removes the role and logs the removal
+func (d *Data) removeRole(name, engineer, message string) bool {
+	for i, r := range d.Roles {
+		if r.Name == name {
+			d.Roles = append(d.Roles[:i], d.Roles[i+1:]...)
+			if err := d.LogRemoval("ROLE_REMOVE", name, engineer, message); err != nil {
+				log.Warnf("Failed to log role removal: %v", err)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// SetRoleParameter sets a parameter of an assigned role
+func (d *Data) SetRoleParameter(name, key, value, engineer, message string) (bool, error) {
+	for i, r := range d.Roles {
+		if r.Name != name {
+			continue
+		}
+		current, found := r.Parameters[key]
+		if found && current == value {
+			return false, nil
+		}
+		old := ""
+		if found {
+			old = fmt.Sprintf("%s: %s=%s", name, key, current)
+		}
+		if err := d.PreChange("ROLE_PARAM", old, fmt.Sprintf("%s: %s=%s", name, key, value), engineer, message); err != nil {
+			return false, err
+		}
+		if d.Roles[i].Parameters == nil {
+			d.Roles[i].Parameters = map[string]string{}
+		}
+		d.Roles[i].Parameters[key] = value
+		if err := d.LogChange("ROLE_PARAM", old, fmt.Sprintf("%s: %s=%s", name, key, value), engineer, message); err != nil {
+			log.Warnf("Failed to log role parameter: %v", err)
+		}
+		return true, nil
+	}
+	return false, fmt.Errorf("role %s not found", name)
+}
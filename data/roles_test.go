@@ -0,0 +1,206 @@
+package data
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jvzantvoort/scmt/config"
+)
+
+func newTestData(t *testing.T) *Data {
+	t.Helper()
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		Configdir:      tmpDir,
+		ConfigDatafile: filepath.Join(tmpDir, "data.json"),
+		Logfile:        filepath.Join(tmpDir, "test.log"),
+	}
+
+	d, err := New(*cfg)
+	if err != nil {
+		t.Fatalf("Failed to create data: %v", err)
+	}
+	return d
+}
+
+func TestData_AddRoleEntry(t *testing.T) {
+	d := newTestData(t)
+
+	role := Role{
+		Name:        "web-server",
+		Description: "Public web frontend",
+		Parameters:  map[string]string{"port": "8080"},
+	}
+	changed, err := d.AddRoleEntry(role, "testuser", "new frontend")
+	if err != nil {
+		t.Fatalf("Failed to add role: %v", err)
+	}
+	if !changed {
+		t.Error("Expected AddRoleEntry to return true for new role")
+	}
+
+	got, err := d.GetRole("web-server")
+	if err != nil {
+		t.Fatalf("Failed to get role: %v", err)
+	}
+	if got.Description != "Public web frontend" {
+		t.Errorf("Expected description 'Public web frontend', got '%s'", got.Description)
+	}
+	if got.Engineer != "testuser" || got.Message != "new frontend" {
+		t.Errorf("Expected engineer and message to be recorded, got %+v", got)
+	}
+	if got.Added.IsZero() {
+		t.Error("Expected added timestamp to be set")
+	}
+	if got.Parameters["port"] != "8080" {
+		t.Errorf("Expected parameter port=8080, got %v", got.Parameters)
+	}
+
+	// GetRole returns a copy
+	got.Parameters["port"] = "9090"
+	again, _ := d.GetRole("web-server")
+	if again.Parameters["port"] != "8080" {
+		t.Error("GetRole should return a copy of the parameters")
+	}
+
+	if _, err := d.GetRole("nonexistent"); err == nil {
+		t.Error("Expected error for non-existent role")
+	}
+}
+
+func TestData_SetRoleParameter(t *testing.T) {
+	d := newTestData(t)
+
+	if _, err := d.AddRole("database", "testuser", "test"); err != nil {
+		t.Fatalf("Failed to add role: %v", err)
+	}
+
+	changed, err := d.SetRoleParameter("database", "port", "5432", "testuser", "test")
+	if err != nil || !changed {
+		t.Fatalf("Expected parameter to be set, got changed=%t err=%v", changed, err)
+	}
+	changed, err = d.SetRoleParameter("database", "port", "5432", "testuser", "test")
+	if err != nil || changed {
+		t.Errorf("Expected unchanged parameter, got changed=%t err=%v", changed, err)
+	}
+	if _, err := d.SetRoleParameter("nonexistent", "port", "1", "testuser", "test"); err == nil {
+		t.Error("Expected error for non-existent role")
+	}
+
+	role, _ := d.GetRole("database")
+	if role.ParameterString() != "port=5432" {
+		t.Errorf("Expected 'port=5432', got '%s'", role.ParameterString())
+	}
+}
+
+func TestRole_BackwardCompatibleLoading(t *testing.T) {
+	d := newTestData(t)
+
+	content := `{
+		"elements": [],
+		"roles": [
+			"web-server",
+			{"name": "database", "description": "Primary", "engineer": "alice", "message": "m",
+			 "added": "2024-01-01T00:00:00Z", "parameters": {"port": "5432"}}
+		]
+	}`
+	if err := d.Reader(strings.NewReader(content)); err != nil {
+		t.Fatalf("Failed to read mixed roles: %v", err)
+	}
+
+	if !d.HasRole("web-server") || !d.HasRole("database") {
+		t.Fatalf("Expected both roles to be loaded, got %v", d.ListRoles())
+	}
+	role, _ := d.GetRole("database")
+	if role.Engineer != "alice" || role.Parameters["port"] != "5432" {
+		t.Errorf("Expected structured role to be loaded, got %+v", role)
+	}
+
+	// Saving writes the structured form for every role
+	var buf bytes.Buffer
+	if err := d.Writer(&buf); err != nil {
+		t.Fatalf("Failed to write data: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"name": "web-server"`) {
+		t.Errorf("Expected structured role in output, got: %s", buf.String())
+	}
+}
+
+func TestParseParameters(t *testing.T) {
+	params, err := ParseParameters([]string{"port=8080", "path=/a=b"})
+	if err != nil {
+		t.Fatalf("Failed to parse parameters: %v", err)
+	}
+	if params["port"] != "8080" || params["path"] != "/a=b" {
+		t.Errorf("Unexpected parameters %v", params)
+	}
+
+	for _, invalid := range []string{"port", "=8080"} {
+		if _, err := ParseParameters([]string{invalid}); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+func TestData_AddRoleEntries(t *testing.T) {
+	d := newCatalogTestData(t, testCatalog)
+
+	added, err := d.AddRoleEntries([]Role{{Name: "web-server"}, {Name: "monitoring"}}, "testuser", "test")
+	if err != nil {
+		t.Fatalf("Failed to add roles: %v", err)
+	}
+	if strings.Join(added, ",") != "tls-client,web-server,monitoring" {
+		t.Errorf("Expected tls-client,web-server,monitoring, got %v", added)
+	}
+
+	// A conflict within the set adds nothing
+	_, err = d.AddRoleEntries([]Role{{Name: "bastion"}, {Name: "database"}}, "testuser", "test")
+	if err == nil {
+		t.Error("Expected error for conflicting roles")
+	}
+	if d.HasRole("bastion") || d.HasRole("database") {
+		t.Errorf("Expected no roles to be added, got %v", d.ListRoles())
+	}
+}
+
+func TestData_SetRoles(t *testing.T) {
+	d := newCatalogTestData(t, testCatalog)
+
+	if _, err := d.AddRoleEntries([]Role{{Name: "bastion"}, {Name: "monitoring"}}, "testuser", "test"); err != nil {
+		t.Fatalf("Failed to add roles: %v", err)
+	}
+
+	// Replacing bastion by database does not conflict
+	added, removed, err := d.SetRoles([]string{"database", "web-server", "monitoring"}, "testuser", "test")
+	if err != nil {
+		t.Fatalf("Failed to set roles: %v", err)
+	}
+	if strings.Join(added, ",") != "database,tls-client,web-server" {
+		t.Errorf("Expected database,tls-client,web-server added, got %v", added)
+	}
+	if strings.Join(removed, ",") != "bastion" {
+		t.Errorf("Expected bastion removed, got %v", removed)
+	}
+
+	// Required roles are kept even when not listed
+	added, removed, err = d.SetRoles([]string{"web-server"}, "testuser", "test")
+	if err != nil {
+		t.Fatalf("Failed to set roles: %v", err)
+	}
+	if len(added) != 0 || strings.Join(removed, ",") != "monitoring,database" {
+		t.Errorf("Expected monitoring,database removed, got added %v removed %v", added, removed)
+	}
+	if strings.Join(d.ListRoles(), ",") != "tls-client,web-server" {
+		t.Errorf("Expected tls-client,web-server, got %v", d.ListRoles())
+	}
+
+	// A refused set changes nothing
+	if _, _, err := d.SetRoles([]string{"database", "bastion"}, "testuser", "test"); err == nil {
+		t.Error("Expected error for conflicting roles")
+	}
+	if strings.Join(d.ListRoles(), ",") != "tls-client,web-server" {
+		t.Errorf("Expected roles to be unchanged, got %v", d.ListRoles())
+	}
+}
@@ -0,0 +1,217 @@
+package facts
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jvzantvoort/scmt/utils"
+	"github.com/olekukonko/tablewriter"
+)
+
+var (
+	// procDir and osReleaseFile are variables so tests can point them at
+	// fixtures
+	procDir       = "/proc"
+	osReleaseFile = "/etc/os-release"
+
+	// lookupTimeout bounds the DNS lookup for the FQDN
+	lookupTimeout = 2 * time.Second
+)
+
+// Facts describes the local host. Facts are gathered on every run and never
+// stored, unlike the audited configuration elements.
+type Facts struct {
+	Hostname    string `json:"hostname"`     // Short hostname
+	FQDN        string `json:"fqdn"`         // Fully qualified domain name
+	PrimaryIP   string `json:"primary_ip"`   // Source address of the default route
+	OSID        string `json:"os_id"`        // ID from os-release, e.g. debian
+	OSVersion   string `json:"os_version"`   // VERSION_ID from os-release
+	OSName      string `json:"os_name"`      // PRETTY_NAME from os-release
+	Kernel      string `json:"kernel"`       // Kernel release
+	Arch        string `json:"arch"`         // Go architecture name, e.g. amd64
+	CPUCount    int    `json:"cpu_count"`    // Number of logical CPUs
+	MemoryTotal uint64 `json:"memory_total"` // Total memory in bytes
+}
+
+// Gather collects the facts of the local host. Facts that cannot be
+// determined are left empty.
+func Gather() Facts {
+	utils.LogStart()
+	defer utils.LogEnd()
+
+	retv := Facts{
+		Arch:     runtime.GOARCH,
+		CPUCount: runtime.NumCPU(),
+	}
+
+	if hostname, err := os.Hostname(); err == nil {
+		retv.Hostname, _, _ = strings.Cut(hostname, ".")
+		retv.FQDN = fqdn(hostname)
+	} else {
+		utils.Debugf("cannot determine hostname: %s", err)
+	}
+
+	retv.PrimaryIP = primaryIP()
+
+	release := osRelease(osReleaseFile)
+	retv.OSID = release["ID"]
+	retv.OSVersion = release["VERSION_ID"]
+	retv.OSName = release["PRETTY_NAME"]
+
+	if content, err := os.ReadFile(filepath.Join(procDir, "sys", "kernel", "osrelease")); err == nil {
+		retv.Kernel = strings.TrimSpace(string(content))
+	}
+
+	retv.MemoryTotal = memoryTotal(filepath.Join(procDir, "meminfo"))
+
+	return retv
+}
+
+// fqdn returns the canonical name of hostname, or hostname itself when it
+// cannot be resolved
+func fqdn(hostname string) string {
+	if strings.Contains(hostname, ".") {
+		return hostname
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+
+	cname, err := net.DefaultResolver.LookupCNAME(ctx, hostname)
+	if err != nil {
+		utils.Debugf("cannot resolve %s: %s", hostname, err)
+		return hostname
+	}
+	return strings.TrimSuffix(cname, ".")
+}
+
+// primaryIP returns the source address used to reach the internet. No
+// packets are sent, connecting a UDP socket only selects a route. Without a
+// route the first global unicast interface address is used.
+func primaryIP() string {
+	if conn, err := net.Dial("udp", "192.0.2.1:9"); err == nil {
+		defer conn.Close()
+		if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+			return addr.IP.String()
+		}
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		utils.Debugf("cannot list interface addresses: %s", err)
+		return ""
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.IsGlobalUnicast() {
+			return ipnet.IP.String()
+		}
+	}
+	return ""
+}
+
+// osRelease parses an os-release(5) file into a map
+func osRelease(path string) map[string]string {
+	retv := map[string]string{}
+
+	filehandle, err := os.Open(path)
+	if err != nil {
+		utils.Debugf("cannot read %s: %s", path, err)
+		return retv
+	}
+	defer filehandle.Close()
+
+	scanner := bufio.NewScanner(filehandle)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `'"`)
+		}
+		retv[key] = value
+	}
+	return retv
+}
+
+// memoryTotal returns MemTotal from a meminfo file in bytes
+func memoryTotal(path string) uint64 {
+	filehandle, err := os.Open(path)
+	if err != nil {
+		utils.Debugf("cannot read %s: %s", path, err)
+		return 0
+	}
+	defer filehandle.Close()
+
+	scanner := bufio.NewScanner(filehandle)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0
+		}
+		return kb * 1024
+	}
+	return 0
+}
+
+// rows returns the facts as name/value pairs in a stable order
+func (f Facts) rows() [][]string {
+	return [][]string{
+		{"hostname", f.Hostname},
+		{"fqdn", f.FQDN},
+		{"primary_ip", f.PrimaryIP},
+		{"os_id", f.OSID},
+		{"os_version", f.OSVersion},
+		{"os_name", f.OSName},
+		{"kernel", f.Kernel},
+		{"arch", f.Arch},
+		{"cpu_count", strconv.Itoa(f.CPUCount)},
+		{"memory_total", strconv.FormatUint(f.MemoryTotal, 10)},
+	}
+}
+
+// Dumper outputs the facts in either JSON or table format to the writer.
+func (f Facts) Dumper(outputtype string, writer io.Writer) error {
+	utils.LogStart()
+	defer utils.LogEnd()
+
+	if outputtype == "json" {
+		content, err := json.MarshalIndent(f, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(writer, "%s\n", string(content))
+		return err
+	}
+
+	if outputtype == "table" {
+		table := tablewriter.NewWriter(writer)
+		table.Header([]string{"Name", "Value"})
+		if err := table.Bulk(f.rows()); err != nil {
+			return err
+		}
+		return table.Render()
+	}
+
+	return nil
+}
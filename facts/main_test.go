@@ -0,0 +1,126 @@
+package facts
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// setupFixtures points the fact sources at files in a temporary directory
+func setupFixtures(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	files := map[string]string{
+		"os-release": `# comment
+NAME="Debian GNU/Linux"
+ID=debian
+VERSION_ID="12"
+PRETTY_NAME="Debian GNU/Linux 12 (bookworm)"
+`,
+		"proc/meminfo": `MemTotal:        8039356 kB
+MemFree:          123456 kB
+`,
+		"proc/sys/kernel/osrelease": "6.1.0-18-amd64\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create fixture directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create fixture %s: %v", name, err)
+		}
+	}
+
+	origProc, origRelease := procDir, osReleaseFile
+	procDir = filepath.Join(tmpDir, "proc")
+	osReleaseFile = filepath.Join(tmpDir, "os-release")
+	t.Cleanup(func() {
+		procDir, osReleaseFile = origProc, origRelease
+	})
+}
+
+func TestGather(t *testing.T) {
+	setupFixtures(t)
+
+	f := Gather()
+
+	if f.OSID != "debian" {
+		t.Errorf("Expected os_id 'debian', got '%s'", f.OSID)
+	}
+	if f.OSVersion != "12" {
+		t.Errorf("Expected os_version '12', got '%s'", f.OSVersion)
+	}
+	if f.OSName != "Debian GNU/Linux 12 (bookworm)" {
+		t.Errorf("Expected os_name 'Debian GNU/Linux 12 (bookworm)', got '%s'", f.OSName)
+	}
+	if f.Kernel != "6.1.0-18-amd64" {
+		t.Errorf("Expected kernel '6.1.0-18-amd64', got '%s'", f.Kernel)
+	}
+	if f.MemoryTotal != 8039356*1024 {
+		t.Errorf("Expected memory_total %d, got %d", 8039356*1024, f.MemoryTotal)
+	}
+	if f.CPUCount != runtime.NumCPU() {
+		t.Errorf("Expected cpu_count %d, got %d", runtime.NumCPU(), f.CPUCount)
+	}
+
+	hostname, _ := os.Hostname()
+	short, _, _ := strings.Cut(hostname, ".")
+	if f.Hostname != short {
+		t.Errorf("Expected hostname '%s', got '%s'", short, f.Hostname)
+	}
+	if f.FQDN == "" {
+		t.Error("Expected non-empty fqdn")
+	}
+}
+
+func TestGather_MissingSources(t *testing.T) {
+	origProc, origRelease := procDir, osReleaseFile
+	procDir = filepath.Join(t.TempDir(), "nonexistent")
+	osReleaseFile = filepath.Join(t.TempDir(), "nonexistent")
+	defer func() { procDir, osReleaseFile = origProc, origRelease }()
+
+	f := Gather()
+	if f.OSID != "" || f.Kernel != "" || f.MemoryTotal != 0 {
+		t.Errorf("Expected empty facts for missing sources, got %+v", f)
+	}
+}
+
+func TestFacts_Dumper(t *testing.T) {
+	f := Facts{
+		Hostname:    "web01",
+		FQDN:        "web01.example.com",
+		PrimaryIP:   "10.0.0.5",
+		CPUCount:    4,
+		MemoryTotal: 1024,
+	}
+
+	var buf bytes.Buffer
+	if err := f.Dumper("json", &buf); err != nil {
+		t.Fatalf("Failed to dump facts as JSON: %v", err)
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON output: %v", err)
+	}
+	if result["fqdn"] != "web01.example.com" {
+		t.Errorf("Expected fqdn 'web01.example.com', got %v", result["fqdn"])
+	}
+	if result["cpu_count"] != float64(4) {
+		t.Errorf("Expected cpu_count 4, got %v", result["cpu_count"])
+	}
+
+	buf.Reset()
+	if err := f.Dumper("table", &buf); err != nil {
+		t.Fatalf("Failed to dump facts as table: %v", err)
+	}
+	for _, expected := range []string{"web01.example.com", "10.0.0.5", "cpu_count"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("Expected table output to contain '%s', got: %s", expected, buf.String())
+		}
+	}
+}
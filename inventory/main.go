@@ -0,0 +1,297 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jvzantvoort/scmt/config"
+	"github.com/jvzantvoort/scmt/data"
+	"github.com/jvzantvoort/scmt/utils"
+)
+
+// HostnameOption is the element naming the host of a data file
+const HostnameOption string = "HOSTNAME"
+
+// RolesVariable is the host variable holding the roles of a host
+const RolesVariable string = "scmt_roles"
+
+// invalidGroup matches the characters Ansible does not allow in group names
+var invalidGroup = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// reservedGroups are the groups Ansible defines itself and the keys of the
+// dynamic inventory next to the groups
+var reservedGroups = map[string]bool{"all": true, "ungrouped": true, "_meta": true}
+
+// Host is a server read from a collected data file
+type Host struct {
+	Name  string            `json:"name"`
+	File  string            `json:"file"`
+	Vars  map[string]string `json:"vars"`
+	Roles []string          `json:"roles"`
+}
+
+// Inventory holds the hosts of a directory of collected data files grouped
+// by role and by the values of selected options
+type Inventory struct {
+	Hosts  map[string]Host
+	Groups map[string][]string
+
+	sources map[string]string // role or option value each group is named after
+}
+
+// Load reads every data file in dir: files named <host>.json and
+// <host>/data.json. The HOSTNAME element, when set, names the host instead
+// of the file. The role catalog of cfg supplies the role defaults.
+func Load(cfg config.Config, dir string, groupBy []string) (*Inventory, error) {
+	utils.LogStart()
+	defer utils.LogEnd()
+
+	retv := &Inventory{Hosts: map[string]Host{}, Groups: map[string][]string{}, sources: map[string]string{}}
+
+	files, err := dataFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		host, err := loadHost(cfg, file)
+		if err != nil {
+			return nil, err
+		}
+		if other, found := retv.Hosts[host.Name]; found {
+			return nil, fmt.Errorf("host %s is defined by both %s and %s", host.Name, other.File, host.File)
+		}
+		retv.Hosts[host.Name] = *host
+
+		for _, role := range host.Roles {
+			if err := retv.addToGroup(GroupName(role), "role "+role, host.Name); err != nil {
+				return nil, err
+			}
+		}
+		for _, option := range groupBy {
+			if value, found := host.Vars[option]; found && value != "" {
+				if err := retv.addToGroup(GroupName(option+"_"+value), option+"="+value, host.Name); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	for name := range retv.Groups {
+		sort.Strings(retv.Groups[name])
+	}
+	return retv, nil
+}
+
+// dataFiles returns the data files in dir, sorted
+func dataFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	retv := []string{}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() {
+			if _, err := os.Stat(filepath.Join(path, "data.json")); err == nil {
+				retv = append(retv, filepath.Join(path, "data.json"))
+			}
+		} else if filepath.Ext(entry.Name()) == ".json" {
+			retv = append(retv, path)
+		}
+	}
+	sort.Strings(retv)
+	return retv, nil
+}
+
+// loadHost reads a single data file
+func loadHost(cfg config.Config, file string) (*Host, error) {
+	cfg.ConfigDatafile = file
+	d, err := data.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.Open(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+
+	vars, err := d.EffectiveMap()
+	if err != nil {
+		return nil, err
+	}
+
+	name := vars[HostnameOption]
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(file), ".json")
+		if filepath.Base(file) == "data.json" {
+			name = filepath.Base(filepath.Dir(file))
+		}
+	}
+
+	return &Host{Name: name, File: file, Vars: vars, Roles: d.ListRoles()}, nil
+}
+
+// addToGroup adds a host to the group named after source. Reserved group
+// names are refused, as are groups named after more than one source, like
+// the roles web-server and web_server.
+func (inv *Inventory) addToGroup(group, source, host string) error {
+	if reservedGroups[group] {
+		return fmt.Errorf("%s of host %s gives the reserved group name %s", source, host, group)
+	}
+	if other, found := inv.sources[group]; found && other != source {
+		return fmt.Errorf("%s and %s both give group %s", other, source, group)
+	}
+	inv.sources[group] = source
+
+	for _, name := range inv.Groups[group] {
+		if name == host {
+			return nil
+		}
+	}
+	inv.Groups[group] = append(inv.Groups[group], host)
+	return nil
+}
+
+// GroupName turns a role or option value into a valid Ansible group name
+func GroupName(name string) string {
+	return strings.ToLower(invalidGroup.ReplaceAllString(name, "_"))
+}
+
+// HostVars returns the variables of a host as Ansible sees them: the
+// configuration and the roles in scmt_roles
+func (inv Inventory) HostVars(name string) (map[string]interface{}, error) {
+	host, found := inv.Hosts[name]
+	if !found {
+		return nil, fmt.Errorf("host %s not found", name)
+	}
+
+	retv := map[string]interface{}{}
+	for key, value := range host.Vars {
+		retv[key] = value
+	}
+	retv[RolesVariable] = host.Roles
+	return retv, nil
+}
+
+// hostNames returns the sorted host names
+func (inv Inventory) hostNames() []string {
+	retv := make([]string, 0, len(inv.Hosts))
+	for name := range inv.Hosts {
+		retv = append(retv, name)
+	}
+	sort.Strings(retv)
+	return retv
+}
+
+// groupNames returns the sorted group names
+func (inv Inventory) groupNames() []string {
+	retv := make([]string, 0, len(inv.Groups))
+	for name := range inv.Groups {
+		retv = append(retv, name)
+	}
+	sort.Strings(retv)
+	return retv
+}
+
+// ungrouped returns the hosts that are in no group
+func (inv Inventory) ungrouped() []string {
+	grouped := map[string]bool{}
+	for _, hosts := range inv.Groups {
+		for _, host := range hosts {
+			grouped[host] = true
+		}
+	}
+
+	retv := []string{}
+	for _, name := range inv.hostNames() {
+		if !grouped[name] {
+			retv = append(retv, name)
+		}
+	}
+	return retv
+}
+
+// List writes the inventory as JSON in the format of an Ansible dynamic
+// inventory script called with --list
+func (inv Inventory) List(writer io.Writer) error {
+	output := map[string]interface{}{}
+
+	hostvars := map[string]interface{}{}
+	for _, name := range inv.hostNames() {
+		vars, _ := inv.HostVars(name)
+		hostvars[name] = vars
+	}
+	output["_meta"] = map[string]interface{}{"hostvars": hostvars}
+
+	children := append(inv.groupNames(), "ungrouped")
+	sort.Strings(children)
+	output["all"] = map[string]interface{}{"children": children}
+	output["ungrouped"] = map[string]interface{}{"hosts": inv.ungrouped()}
+	for _, name := range inv.groupNames() {
+		output[name] = map[string]interface{}{"hosts": inv.Groups[name]}
+	}
+
+	return writeJSON(output, writer)
+}
+
+// Host writes the variables of a host as JSON, as an Ansible dynamic
+// inventory script called with --host
+func (inv Inventory) Host(name string, writer io.Writer) error {
+	vars, err := inv.HostVars(name)
+	if err != nil {
+		return err
+	}
+	return writeJSON(vars, writer)
+}
+
+// YAML writes the inventory as Ansible YAML inventory file
+func (inv Inventory) YAML(writer io.Writer) error {
+	hosts := map[string]interface{}{}
+	for _, name := range inv.hostNames() {
+		vars, _ := inv.HostVars(name)
+		hosts[name] = vars
+	}
+
+	children := map[string]interface{}{}
+	for _, name := range inv.groupNames() {
+		members := map[string]interface{}{}
+		for _, host := range inv.Groups[name] {
+			members[host] = nil
+		}
+		children[name] = map[string]interface{}{"hosts": members}
+	}
+
+	all := map[string]interface{}{"hosts": hosts}
+	if len(children) > 0 {
+		all["children"] = children
+	}
+
+	encoder := yaml.NewEncoder(writer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(map[string]interface{}{"all": all}); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// writeJSON writes content as indented JSON
+func writeJSON(content interface{}, writer io.Writer) error {
+	jsonBytes, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(writer, "%s\n", string(jsonBytes))
+	return err
+}
@@ -0,0 +1,209 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jvzantvoort/scmt/config"
+	"github.com/jvzantvoort/scmt/data"
+)
+
+// writeDataFile writes a data file with the given options and roles
+func writeDataFile(t *testing.T, file string, options map[string]string, roles ...string) {
+	t.Helper()
+	cfg := config.Config{
+		ConfigDatafile: file,
+		Configdir:      filepath.Dir(file),
+		Logfile:        filepath.Join(t.TempDir(), "test.log"),
+	}
+	d, err := data.New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create data: %v", err)
+	}
+	for option, value := range options {
+		if _, err := d.Set(option, value, "testuser", "test"); err != nil {
+			t.Fatalf("Failed to set option: %v", err)
+		}
+	}
+	for _, role := range roles {
+		if _, err := d.AddRole(role, "testuser", "test"); err != nil {
+			t.Fatalf("Failed to add role: %v", err)
+		}
+	}
+	if err := d.Save(); err != nil {
+		t.Fatalf("Failed to save data: %v", err)
+	}
+}
+
+// loadTestInventory returns an inventory of three collected hosts
+func loadTestInventory(t *testing.T) *Inventory {
+	t.Helper()
+	dir := t.TempDir()
+	writeDataFile(t, filepath.Join(dir, "web01.json"), map[string]string{"ENVIRONMENT": "production"}, "web-server", "monitoring")
+	writeDataFile(t, filepath.Join(dir, "db01", "data.json"), map[string]string{"ENVIRONMENT": "production"}, "database")
+	writeDataFile(t, filepath.Join(dir, "renamed.json"), map[string]string{"HOSTNAME": "test01", "ENVIRONMENT": "test"})
+	writeDataFile(t, filepath.Join(dir, "spare.json"), map[string]string{"TYPE": "server"})
+	if err := os.WriteFile(filepath.Join(dir, "README.txt"), []byte("ignored"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	inv, err := Load(config.Config{}, dir, []string{"ENVIRONMENT"})
+	if err != nil {
+		t.Fatalf("Failed to load inventory: %v", err)
+	}
+	return inv
+}
+
+func TestLoad(t *testing.T) {
+	inv := loadTestInventory(t)
+
+	if len(inv.Hosts) != 4 {
+		t.Errorf("Expected 4 hosts, got %v", inv.Hosts)
+	}
+	for _, name := range []string{"web01", "db01", "test01", "spare"} {
+		if _, found := inv.Hosts[name]; !found {
+			t.Errorf("Expected host %s", name)
+		}
+	}
+
+	expected := map[string]string{
+		"web_server":             "web01",
+		"monitoring":             "web01",
+		"database":               "db01",
+		"environment_production": "db01,web01",
+		"environment_test":       "test01",
+	}
+	if len(inv.Groups) != len(expected) {
+		t.Errorf("Expected %d groups, got %v", len(expected), inv.Groups)
+	}
+	for group, hosts := range expected {
+		if strings.Join(inv.Groups[group], ",") != hosts {
+			t.Errorf("Expected group %s to hold %s, got %v", group, hosts, inv.Groups[group])
+		}
+	}
+	if strings.Join(inv.ungrouped(), ",") != "spare" {
+		t.Errorf("Expected spare to be ungrouped, got %v", inv.ungrouped())
+	}
+}
+
+func TestLoad_DuplicateHost(t *testing.T) {
+	dir := t.TempDir()
+	writeDataFile(t, filepath.Join(dir, "web01.json"), map[string]string{"TYPE": "server"})
+	writeDataFile(t, filepath.Join(dir, "other.json"), map[string]string{"HOSTNAME": "web01"})
+
+	if _, err := Load(config.Config{}, dir, nil); err == nil {
+		t.Error("Expected error for a host defined twice")
+	}
+	if _, err := Load(config.Config{}, filepath.Join(dir, "nonexistent"), nil); err == nil {
+		t.Error("Expected error for a missing directory")
+	}
+}
+
+func TestLoad_GroupNames(t *testing.T) {
+	tests := map[string]struct {
+		roles   []string
+		options map[string]string
+	}{
+		"all":             {roles: []string{"all"}},
+		"ungrouped":       {roles: []string{"Ungrouped"}},
+		"meta":            {roles: []string{"_meta"}},
+		"colliding roles": {roles: []string{"web-server", "web_server"}},
+		"role and value":  {roles: []string{"env_test"}, options: map[string]string{"ENV": "test"}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeDataFile(t, filepath.Join(dir, "web01.json"), tt.options, tt.roles...)
+			if _, err := Load(config.Config{}, dir, []string{"ENV"}); err == nil {
+				t.Error("Expected error for the group names")
+			}
+		})
+	}
+
+	// Roles of different hosts collide as well
+	dir := t.TempDir()
+	writeDataFile(t, filepath.Join(dir, "web01.json"), nil, "web-server")
+	writeDataFile(t, filepath.Join(dir, "web02.json"), nil, "Web.Server")
+	if _, err := Load(config.Config{}, dir, nil); err == nil {
+		t.Error("Expected error for roles of different hosts giving the same group")
+	}
+}
+
+func TestInventory_List(t *testing.T) {
+	inv := loadTestInventory(t)
+
+	var buf bytes.Buffer
+	if err := inv.List(&buf); err != nil {
+		t.Fatalf("Failed to list inventory: %v", err)
+	}
+
+	var output struct {
+		Meta struct {
+			Hostvars map[string]map[string]interface{} `json:"hostvars"`
+		} `json:"_meta"`
+		All struct {
+			Children []string `json:"children"`
+		} `json:"all"`
+		WebServer struct {
+			Hosts []string `json:"hosts"`
+		} `json:"web_server"`
+		Ungrouped struct {
+			Hosts []string `json:"hosts"`
+		} `json:"ungrouped"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &output); err != nil {
+		t.Fatalf("Failed to parse inventory: %v", err)
+	}
+
+	if output.Meta.Hostvars["web01"]["ENVIRONMENT"] != "production" {
+		t.Errorf("Expected hostvars for web01, got %v", output.Meta.Hostvars["web01"])
+	}
+	if strings.Join(output.All.Children, ",") != "database,environment_production,environment_test,monitoring,ungrouped,web_server" {
+		t.Errorf("Unexpected children of all: %v", output.All.Children)
+	}
+	if strings.Join(output.WebServer.Hosts, ",") != "web01" || strings.Join(output.Ungrouped.Hosts, ",") != "spare" {
+		t.Errorf("Unexpected groups: %+v %+v", output.WebServer, output.Ungrouped)
+	}
+
+	buf.Reset()
+	if err := inv.Host("web01", &buf); err != nil {
+		t.Fatalf("Failed to show host: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"scmt_roles": [`) {
+		t.Errorf("Expected scmt_roles in host variables, got %s", buf.String())
+	}
+	if err := inv.Host("nonexistent", &buf); err == nil {
+		t.Error("Expected error for an unknown host")
+	}
+}
+
+func TestInventory_YAML(t *testing.T) {
+	inv := loadTestInventory(t)
+
+	var buf bytes.Buffer
+	if err := inv.YAML(&buf); err != nil {
+		t.Fatalf("Failed to write YAML inventory: %v", err)
+	}
+	for _, expected := range []string{"all:\n", "  children:\n", "    web_server:\n      hosts:\n        web01: null\n", "  hosts:\n"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("Expected YAML to contain %q, got:\n%s", expected, buf.String())
+		}
+	}
+}
+
+func TestGroupName(t *testing.T) {
+	tests := map[string]string{
+		"web-server":             "web_server",
+		"ENVIRONMENT_production": "environment_production",
+		"zone_eu.west-1":         "zone_eu_west_1",
+	}
+	for name, expected := range tests {
+		if got := GroupName(name); got != expected {
+			t.Errorf("GroupName(%q): expected %q, got %q", name, expected, got)
+		}
+	}
+}
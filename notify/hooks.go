@@ -0,0 +1,192 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jvzantvoort/scmt/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// Hook phases, hooks named with the pre- prefix run before a change and can
+// veto it, the other hooks run after the change is committed
+const (
+	HookPre  string = "pre"
+	HookPost string = "post"
+)
+
+// PreHookPrefix is the name prefix of the hooks that run before a change
+const PreHookPrefix string = "pre-"
+
+// DefaultHookTimeout is the time a hook may run before it is killed
+const DefaultHookTimeout time.Duration = 30 * time.Second
+
+// hookName matches the names run-parts accepts, so backup and package
+// manager files like hook~ or hook.dpkg-old are skipped
+var hookName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// VetoError is returned when a pre- hook vetoes a change
+type VetoError struct {
+	Hook   string
+	Option string
+	Err    error
+}
+
+func (e *VetoError) Error() string {
+	return fmt.Sprintf("hook %s vetoed the change of %s: %v", e.Hook, e.Option, e.Err)
+}
+
+func (e *VetoError) Unwrap() error {
+	return e.Err
+}
+
+// Hooks runs the executables in a hooks directory, in the order of their
+// names, for every change
+type Hooks struct {
+	Dir     string
+	Timeout time.Duration
+}
+
+// NewHooks returns the hooks in dir, a zero timeout is DefaultHookTimeout
+func NewHooks(dir string, timeout time.Duration) Hooks {
+	if timeout <= 0 {
+		timeout = DefaultHookTimeout
+	}
+	return Hooks{Dir: dir, Timeout: timeout}
+}
+
+// List returns the paths of the hooks of a phase, sorted by name. A missing
+// directory holds no hooks.
+func (h Hooks) List(phase string) ([]string, error) {
+	if h.Dir == "" {
+		return []string{}, nil
+	}
+	// Hooks run in the hooks directory, relative paths would not resolve
+	dir, err := filepath.Abs(h.Dir)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", h.Dir, err)
+	}
+
+	retv := []string{}
+	for _, entry := range entries {
+		if !hookName.MatchString(entry.Name()) {
+			continue
+		}
+		if strings.HasPrefix(entry.Name(), PreHookPrefix) != (phase == HookPre) {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(dir, entry.Name()))
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+			continue
+		}
+		retv = append(retv, filepath.Join(dir, entry.Name()))
+	}
+	sort.Strings(retv)
+	return retv, nil
+}
+
+// RunPre runs the pre- hooks for a change that is about to be made. The
+// first hook that fails vetoes the change: a VetoError is returned and the
+// remaining hooks do not run.
+func (h Hooks) RunPre(event Event) error {
+	utils.LogStart()
+	defer utils.LogEnd()
+
+	hooks, err := h.List(HookPre)
+	if err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		if err := h.run(hook, HookPre, event); err != nil {
+			return &VetoError{Hook: filepath.Base(hook), Option: event.Option, Err: err}
+		}
+	}
+	return nil
+}
+
+// RunPost runs the hooks for a committed change. Every hook runs, the
+// failures are returned so they can be logged.
+func (h Hooks) RunPost(event Event) []error {
+	utils.LogStart()
+	defer utils.LogEnd()
+
+	hooks, err := h.List(HookPost)
+	if err != nil {
+		return []error{err}
+	}
+
+	retv := []error{}
+	for _, hook := range hooks {
+		if err := h.run(hook, HookPost, event); err != nil {
+			retv = append(retv, fmt.Errorf("hook %s failed for the change of %s: %w", filepath.Base(hook), event.Option, err))
+		}
+	}
+	return retv
+}
+
+// run runs a single hook with the change in its environment and as JSON on
+// its stdin
+func (h Hooks) run(hook, phase string, event Event) error {
+	content, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.Timeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, hook)
+	cmd.Dir = h.Dir
+	cmd.Env = append(os.Environ(), event.Environ(phase)...)
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.WaitDelay = time.Second
+
+	log.Debugf("Running %s hook %s for %s", phase, hook, event.Option)
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %s", h.Timeout)
+	}
+	if text := strings.TrimSpace(output.String()); text != "" {
+		// stdout may hold JSON output, so the output is only shown when
+		// debugging and in the error of a failed hook
+		log.Debugf("%s: %s", filepath.Base(hook), text)
+		if err != nil {
+			err = fmt.Errorf("%w: %s", err, text)
+		}
+	}
+	return err
+}
+
+// Environ returns the change as SCMT_HOOK_* environment variables. Plain
+// SCMT_* variables would be read as flags by scmt commands run from a hook.
+func (e Event) Environ(phase string) []string {
+	return []string{
+		"SCMT_HOOK_PHASE=" + phase,
+		"SCMT_HOOK_HOST=" + e.Host,
+		"SCMT_HOOK_OPTION=" + e.Option,
+		"SCMT_HOOK_OLD=" + e.Old,
+		"SCMT_HOOK_NEW=" + e.New,
+		"SCMT_HOOK_ENGINEER=" + e.Engineer,
+		"SCMT_HOOK_MESSAGE=" + e.Message,
+		"SCMT_HOOK_CHANGED=" + e.Changed.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,149 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// writeHook writes an executable shell script into dir
+func writeHook(t *testing.T, dir, name, script string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create hooks dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("Failed to write hook: %v", err)
+	}
+}
+
+func TestHooks_List(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "hooks.d")
+	writeHook(t, dir, "20-chat", "exit 0\n")
+	writeHook(t, dir, "10-reload", "exit 0\n")
+	writeHook(t, dir, "pre-10-check", "exit 0\n")
+	writeHook(t, dir, "10-reload.dpkg-old", "exit 0\n")
+	writeHook(t, dir, "10-reload~", "exit 0\n")
+	if err := os.WriteFile(filepath.Join(dir, "30-not-executable"), []byte("exit 0\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	hooks := NewHooks(dir, 0)
+	if hooks.Timeout != DefaultHookTimeout {
+		t.Errorf("Expected the default timeout, got %s", hooks.Timeout)
+	}
+
+	post, err := hooks.List(HookPost)
+	if err != nil {
+		t.Fatalf("Failed to list hooks: %v", err)
+	}
+	if len(post) != 2 || filepath.Base(post[0]) != "10-reload" || filepath.Base(post[1]) != "20-chat" {
+		t.Errorf("Unexpected post hooks %v", post)
+	}
+
+	pre, _ := hooks.List(HookPre)
+	if len(pre) != 1 || filepath.Base(pre[0]) != "pre-10-check" {
+		t.Errorf("Unexpected pre hooks %v", pre)
+	}
+
+	if missing, err := NewHooks(filepath.Join(dir, "missing"), 0).List(HookPost); err != nil || len(missing) != 0 {
+		t.Errorf("Expected no hooks in a missing directory, got %v, %v", missing, err)
+	}
+}
+
+func TestHooks_RunPost(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "hooks.d")
+	out := filepath.Join(t.TempDir(), "out")
+	writeHook(t, dir, "10-record", `echo "$SCMT_HOOK_PHASE $SCMT_HOOK_OPTION $SCMT_HOOK_OLD $SCMT_HOOK_NEW $SCMT_HOOK_ENGINEER" > `+out+`.env
+cat > `+out+`.json
+`)
+	writeHook(t, dir, "20-fail", "echo broken; exit 3\n")
+	writeHook(t, dir, "30-after", "touch "+out+".after\n")
+
+	errs := NewHooks(dir, time.Minute).RunPost(NewEvent("OWNER", "Mad House", "Ops", "testuser", "handover"))
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "20-fail") || !strings.Contains(errs[0].Error(), "broken") {
+		t.Errorf("Expected the failure of 20-fail, got %v", errs)
+	}
+
+	env, _ := os.ReadFile(out + ".env")
+	if string(env) != "post OWNER Mad House Ops testuser\n" {
+		t.Errorf("Unexpected environment %q", env)
+	}
+
+	content, _ := os.ReadFile(out + ".json")
+	var event Event
+	if err := json.Unmarshal(content, &event); err != nil {
+		t.Fatalf("Failed to parse stdin of the hook: %v", err)
+	}
+	if event.Option != "OWNER" || event.New != "Ops" || event.Message != "handover" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+
+	// A failing hook does not stop the others
+	if _, err := os.Stat(out + ".after"); err != nil {
+		t.Errorf("Expected the hook after the failure to run: %v", err)
+	}
+}
+
+func TestHooks_Output(t *testing.T) {
+	var logged bytes.Buffer
+	output, level := log.StandardLogger().Out, log.GetLevel()
+	log.SetOutput(&logged)
+	log.SetLevel(log.InfoLevel)
+	t.Cleanup(func() {
+		log.SetOutput(output)
+		log.SetLevel(level)
+	})
+
+	dir := filepath.Join(t.TempDir(), "hooks.d")
+	writeHook(t, dir, "10-chatty", "echo chatty output\n")
+
+	// The output of a hook never reaches the log, which shares stdout with
+	// JSON output
+	if errs := NewHooks(dir, time.Minute).RunPost(NewEvent("OWNER", "", "Ops", "testuser", "test")); len(errs) != 0 {
+		t.Fatalf("Expected the hook to succeed, got %v", errs)
+	}
+	if strings.Contains(logged.String(), "chatty output") {
+		t.Errorf("Expected no hook output in the log, got %q", logged.String())
+	}
+}
+
+func TestHooks_RunPre(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "hooks.d")
+	writeHook(t, dir, "pre-10-freeze", `[ "$SCMT_HOOK_OPTION" != "OWNER" ] || { echo "OWNER is frozen"; exit 1; }
+`)
+
+	hooks := NewHooks(dir, time.Minute)
+	if err := hooks.RunPre(NewEvent("TYPE", "", "server", "testuser", "test")); err != nil {
+		t.Errorf("Expected TYPE to be allowed, got %v", err)
+	}
+	err := hooks.RunPre(NewEvent("OWNER", "", "Ops", "testuser", "test"))
+	if err == nil || !strings.Contains(err.Error(), "OWNER is frozen") {
+		t.Errorf("Expected OWNER to be vetoed, got %v", err)
+	}
+	var veto *VetoError
+	if !errors.As(err, &veto) || veto.Hook != "pre-10-freeze" {
+		t.Errorf("Expected a VetoError of pre-10-freeze, got %#v", err)
+	}
+}
+
+func TestHooks_Timeout(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "hooks.d")
+	writeHook(t, dir, "pre-10-slow", "sleep 10\n")
+
+	start := time.Now()
+	err := NewHooks(dir, 100*time.Millisecond).RunPre(NewEvent("OWNER", "", "Ops", "testuser", "test"))
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Expected the hook to be killed, took %s", time.Since(start))
+	}
+}
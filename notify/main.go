@@ -0,0 +1,261 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jvzantvoort/scmt/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// Defaults of the notifier configuration
+const (
+	DefaultTimeout    time.Duration = 5 * time.Second
+	DefaultRetries    int           = 2
+	DefaultRetryDelay time.Duration = time.Second
+)
+
+// Webhook is a URL changes are POSTed to, with optional extra headers such
+// as an Authorization header
+type Webhook struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Config is the layout of the notifier configuration file. Timeout and
+// RetryDelay are durations like "5s".
+type Config struct {
+	Webhooks   []Webhook `json:"webhooks"`
+	Timeout    string    `json:"timeout,omitempty"`
+	Retries    *int      `json:"retries,omitempty"`
+	RetryDelay string    `json:"retry_delay,omitempty"`
+}
+
+// Event is the JSON payload posted for a change
+type Event struct {
+	Host     string    `json:"host"`
+	Option   string    `json:"option"`
+	Old      string    `json:"old"`
+	New      string    `json:"new"`
+	Engineer string    `json:"engineer"`
+	Message  string    `json:"message"`
+	Changed  time.Time `json:"changed"`
+}
+
+// Delivery is an event for a webhook, as stored in the spool directory
+// when it could not be delivered
+type Delivery struct {
+	Webhook Webhook `json:"webhook"`
+	Event   Event   `json:"event"`
+}
+
+// Notifier posts events to the configured webhooks
+type Notifier struct {
+	Spooldir   string
+	Webhooks   []Webhook
+	Retries    int
+	RetryDelay time.Duration
+	client     *http.Client
+}
+
+// New reads the notifier configuration from configfile. Without the file
+// there are no webhooks and sending does nothing.
+func New(configfile, spooldir string) (*Notifier, error) {
+	utils.LogStart()
+	defer utils.LogEnd()
+
+	retv := &Notifier{
+		Spooldir:   spooldir,
+		Webhooks:   []Webhook{},
+		Retries:    DefaultRetries,
+		RetryDelay: DefaultRetryDelay,
+		client:     &http.Client{Timeout: DefaultTimeout},
+	}
+
+	if configfile == "" {
+		return retv, nil
+	}
+	content, err := os.ReadFile(configfile)
+	if os.IsNotExist(err) {
+		return retv, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", configfile, err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(content, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", configfile, err)
+	}
+
+	retv.Webhooks = cfg.Webhooks
+	if cfg.Retries != nil {
+		retv.Retries = *cfg.Retries
+	}
+	if cfg.Timeout != "" {
+		if retv.client.Timeout, err = time.ParseDuration(cfg.Timeout); err != nil {
+			return nil, fmt.Errorf("invalid timeout in %s: %w", configfile, err)
+		}
+	}
+	if cfg.RetryDelay != "" {
+		if retv.RetryDelay, err = time.ParseDuration(cfg.RetryDelay); err != nil {
+			return nil, fmt.Errorf("invalid retry_delay in %s: %w", configfile, err)
+		}
+	}
+	return retv, nil
+}
+
+// NewEvent returns the event of a change on this host
+func NewEvent(option, old, value, engineer, message string) Event {
+	host, _ := os.Hostname()
+	return Event{
+		Host:     host,
+		Option:   option,
+		Old:      old,
+		New:      value,
+		Engineer: engineer,
+		Message:  message,
+		Changed:  time.Now().UTC(),
+	}
+}
+
+// Send posts the event to every webhook. Deliveries that fail after all
+// retries are spooled for Flush, the error reports how many were spooled.
+func (n Notifier) Send(event Event) error {
+	utils.LogStart()
+	defer utils.LogEnd()
+
+	spooled := 0
+	for _, webhook := range n.Webhooks {
+		delivery := Delivery{Webhook: webhook, Event: event}
+		if err := n.deliver(delivery); err != nil {
+			log.Warnf("Failed to notify %s: %v", webhook.URL, err)
+			if err := n.spool(delivery); err != nil {
+				return err
+			}
+			spooled++
+		}
+	}
+
+	if spooled > 0 {
+		return fmt.Errorf("%d of %d notifications failed and were spooled", spooled, len(n.Webhooks))
+	}
+	return nil
+}
+
+// deliver posts a delivery, retrying failed attempts
+func (n Notifier) deliver(delivery Delivery) error {
+	content, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = n.post(delivery.Webhook, content)
+		if err == nil || attempt >= n.Retries {
+			return err
+		}
+		log.Debugf("Attempt %d to notify %s failed: %v", attempt+1, delivery.Webhook.URL, err)
+		time.Sleep(n.RetryDelay)
+	}
+}
+
+// post makes a single attempt to post content to a webhook
+func (n Notifier) post(webhook Webhook, content []byte) error {
+	request, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range webhook.Headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := n.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return nil
+}
+
+// spool stores a delivery in the spool directory. The file holds the
+// headers of the webhook, so only the owner may read it.
+func (n Notifier) spool(delivery Delivery) error {
+	content, err := json.MarshalIndent(delivery, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%020d.json", time.Now().UnixNano())
+	if _, err := utils.WriteFileAtomic(filepath.Join(n.Spooldir, name), content, 0600); err != nil {
+		return fmt.Errorf("failed to spool notification: %w", err)
+	}
+	log.Infof("Spooled notification to %s as %s", delivery.Webhook.URL, name)
+	return nil
+}
+
+// Spooled returns the files in the spool directory, oldest first
+func (n Notifier) Spooled() ([]string, error) {
+	entries, err := os.ReadDir(n.Spooldir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", n.Spooldir, err)
+	}
+
+	retv := []string{}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !strings.HasPrefix(entry.Name(), ".") && filepath.Ext(entry.Name()) == ".json" {
+			retv = append(retv, filepath.Join(n.Spooldir, entry.Name()))
+		}
+	}
+	sort.Strings(retv)
+	return retv, nil
+}
+
+// Flush retries the spooled deliveries, oldest first, removing the ones
+// that are delivered. It returns the number delivered and still spooled.
+func (n Notifier) Flush() (int, int, error) {
+	utils.LogStart()
+	defer utils.LogEnd()
+
+	files, err := n.Spooled()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	delivered := 0
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return delivered, len(files) - delivered, err
+		}
+		var delivery Delivery
+		if err := json.Unmarshal(content, &delivery); err != nil {
+			return delivered, len(files) - delivered, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+
+		if err := n.deliver(delivery); err != nil {
+			log.Warnf("Failed to notify %s: %v", delivery.Webhook.URL, err)
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			return delivered, len(files) - delivered, err
+		}
+		delivered++
+	}
+	return delivered, len(files) - delivered, nil
+}
@@ -0,0 +1,161 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// webhookServer records the events posted to it and fails while failing is
+// set
+type webhookServer struct {
+	sync.Mutex
+	*httptest.Server
+	events  []Event
+	headers []http.Header
+	failing bool
+}
+
+func newWebhookServer(t *testing.T) *webhookServer {
+	t.Helper()
+	retv := &webhookServer{}
+	retv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		retv.Lock()
+		defer retv.Unlock()
+		if retv.failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var event Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		retv.events = append(retv.events, event)
+		retv.headers = append(retv.headers, r.Header.Clone())
+	}))
+	t.Cleanup(retv.Close)
+	return retv
+}
+
+// setFailing makes the server fail requests or accept them again
+func (s *webhookServer) setFailing(failing bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.failing = failing
+}
+
+// writeConfig writes a notifier configuration for the given webhooks
+func writeConfig(t *testing.T, dir string, urls ...string) string {
+	t.Helper()
+	cfg := map[string]interface{}{"retries": 1, "retry_delay": "1ms", "timeout": "1s"}
+	webhooks := []Webhook{}
+	for _, url := range urls {
+		webhooks = append(webhooks, Webhook{URL: url, Headers: map[string]string{"X-Token": "s3cr3t"}})
+	}
+	cfg["webhooks"] = webhooks
+
+	content, _ := json.Marshal(cfg)
+	configfile := filepath.Join(dir, "notify.json")
+	if err := os.WriteFile(configfile, content, 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return configfile
+}
+
+func TestNew_NoConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	notifier, err := New(filepath.Join(tmpDir, "notify.json"), filepath.Join(tmpDir, "spool"))
+	if err != nil {
+		t.Fatalf("Failed to create notifier: %v", err)
+	}
+	if len(notifier.Webhooks) != 0 || notifier.Retries != DefaultRetries {
+		t.Errorf("Unexpected notifier %+v", notifier)
+	}
+	if err := notifier.Send(NewEvent("OWNER", "", "Ops", "testuser", "test")); err != nil {
+		t.Errorf("Expected sending without webhooks to succeed, got %v", err)
+	}
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	configfile := filepath.Join(tmpDir, "notify.json")
+	if err := os.WriteFile(configfile, []byte(`{"timeout": "soon"}`), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if _, err := New(configfile, tmpDir); err == nil {
+		t.Error("Expected error for an invalid timeout")
+	}
+}
+
+func TestNotifier_Send(t *testing.T) {
+	server := newWebhookServer(t)
+	tmpDir := t.TempDir()
+	notifier, err := New(writeConfig(t, tmpDir, server.URL), filepath.Join(tmpDir, "spool"))
+	if err != nil {
+		t.Fatalf("Failed to create notifier: %v", err)
+	}
+
+	if err := notifier.Send(NewEvent("OWNER", "Mad House", "Ops", "testuser", "handover")); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	if len(server.events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(server.events))
+	}
+	event := server.events[0]
+	if event.Option != "OWNER" || event.Old != "Mad House" || event.New != "Ops" || event.Engineer != "testuser" || event.Message != "handover" || event.Host == "" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	if server.headers[0].Get("X-Token") != "s3cr3t" || server.headers[0].Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected headers %v", server.headers[0])
+	}
+}
+
+func TestNotifier_SpoolAndFlush(t *testing.T) {
+	server := newWebhookServer(t)
+	server.setFailing(true)
+	tmpDir := t.TempDir()
+	notifier, err := New(writeConfig(t, tmpDir, server.URL), filepath.Join(tmpDir, "spool"))
+	if err != nil {
+		t.Fatalf("Failed to create notifier: %v", err)
+	}
+
+	if err := notifier.Send(NewEvent("OWNER", "", "Ops", "testuser", "first")); err == nil {
+		t.Error("Expected error for a failing webhook")
+	}
+	if err := notifier.Send(NewEvent("TYPE", "", "server", "testuser", "second")); err == nil {
+		t.Error("Expected error for a failing webhook")
+	}
+
+	files, err := notifier.Spooled()
+	if err != nil || len(files) != 2 {
+		t.Fatalf("Expected 2 spooled notifications, got %v, %v", files, err)
+	}
+	if info, _ := os.Stat(files[0]); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected spooled notifications with mode 0600, got %o", info.Mode().Perm())
+	}
+
+	delivered, remaining, err := notifier.Flush()
+	if err != nil || delivered != 0 || remaining != 2 {
+		t.Errorf("Expected nothing delivered while failing, got %d, %d, %v", delivered, remaining, err)
+	}
+
+	server.setFailing(false)
+	delivered, remaining, err = notifier.Flush()
+	if err != nil || delivered != 2 || remaining != 0 {
+		t.Fatalf("Expected everything delivered, got %d, %d, %v", delivered, remaining, err)
+	}
+
+	// Spooled notifications are delivered oldest first
+	if len(server.events) != 2 || server.events[0].Message != "first" || server.events[1].Message != "second" {
+		t.Errorf("Unexpected events %+v", server.events)
+	}
+	if files, _ := notifier.Spooled(); len(files) != 0 {
+		t.Errorf("Expected an empty spool, got %v", files)
+	}
+}
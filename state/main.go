@@ -0,0 +1,202 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/jvzantvoort/scmt/utils"
+)
+
+// Status of a rendered file compared to its recorded checksum
+const (
+	StatusOK        string = "ok"        // file matches the recorded checksum
+	StatusModified  string = "modified"  // file was changed outside scmt
+	StatusMissing   string = "missing"   // file was removed outside scmt
+	StatusUntracked string = "untracked" // file was never rendered by scmt
+)
+
+// Entry records a file rendered by scmt.
+type Entry struct {
+	Path     string    `json:"path"`     // Absolute path of the rendered file
+	Template string    `json:"template"` // Template the file was rendered from
+	Checksum string    `json:"checksum"` // SHA-256 of the rendered content
+	Engineer string    `json:"engineer"` // Engineer who rendered the file
+	Changed  time.Time `json:"changed"`  // Timestamp of the render
+}
+
+// State holds the checksums of every file rendered by scmt.
+type State struct {
+	Statefile string  `json:"-"`
+	Entries   []Entry `json:"entries"`
+}
+
+// Checksum returns the hex encoded SHA-256 digest of content.
+func Checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// FileChecksum returns the checksum of the file at path.
+func FileChecksum(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return Checksum(content), nil
+}
+
+// absPath normalizes path so relative and absolute references match.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// Writer writes the State as indented JSON to the provided io.Writer.
+func (st State) Writer(writer io.Writer) error {
+	utils.LogStart()
+	defer utils.LogEnd()
+
+	content, err := json.MarshalIndent(st, "", "  ")
+	if err == nil {
+		_, err := fmt.Fprintf(writer, "%s\n", string(content))
+		if err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// Reader loads State from a JSON-encoded io.Reader.
+func (st *State) Reader(reader io.Reader) error {
+	utils.LogStart()
+	defer utils.LogEnd()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, &st)
+}
+
+// Get returns the entry recorded for path.
+func (st State) Get(path string) (*Entry, bool) {
+	path = absPath(path)
+	for i := range st.Entries {
+		if st.Entries[i].Path == path {
+			return &st.Entries[i], true
+		}
+	}
+	return nil, false
+}
+
+// Record stores the checksum of a rendered file, replacing an earlier entry.
+func (st *State) Record(path, template, checksum, engineer string) {
+	utils.LogStart()
+	defer utils.LogEnd()
+
+	entry := Entry{
+		Path:     absPath(path),
+		Template: template,
+		Checksum: checksum,
+		Engineer: engineer,
+		Changed:  time.Now().UTC(),
+	}
+
+	if current, found := st.Get(path); found {
+		*current = entry
+		return
+	}
+	st.Entries = append(st.Entries, entry)
+	sort.Slice(st.Entries, func(i, j int) bool {
+		return st.Entries[i].Path < st.Entries[j].Path
+	})
+}
+
+// Remove forgets the entry recorded for path.
+func (st *State) Remove(path string) bool {
+	path = absPath(path)
+	for i, entry := range st.Entries {
+		if entry.Path == path {
+			st.Entries = append(st.Entries[:i], st.Entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Check compares the file at path with its recorded checksum.
+func (st State) Check(path string) (string, error) {
+	entry, found := st.Get(path)
+	if !found {
+		return StatusUntracked, nil
+	}
+
+	checksum, err := FileChecksum(entry.Path)
+	if os.IsNotExist(err) {
+		return StatusMissing, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if checksum != entry.Checksum {
+		return StatusModified, nil
+	}
+	return StatusOK, nil
+}
+
+// Open loads State from the specified statefile.
+func (st *State) Open() error {
+	utils.LogStart()
+	defer utils.LogEnd()
+
+	// target doesn't exist
+	if _, err := os.Stat(st.Statefile); os.IsNotExist(err) {
+		return nil
+	}
+
+	filehandle, err := os.Open(st.Statefile)
+	if err != nil {
+		return err
+	}
+	defer filehandle.Close()
+
+	return st.Reader(filehandle)
+}
+
+// Save writes State to the specified statefile.
+func (st State) Save() error {
+	utils.LogStart()
+	defer utils.LogEnd()
+
+	if err := utils.MkdirAll(filepath.Dir(st.Statefile)); err != nil {
+		return err
+	}
+
+	filehandle, err := os.OpenFile(st.Statefile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer filehandle.Close()
+	return st.Writer(filehandle)
+}
+
+// New creates a new State instance and loads data from the statefile.
+func New(statefile string) (*State, error) {
+	utils.LogStart()
+	defer utils.LogEnd()
+
+	st := &State{}
+	st.Statefile = statefile
+	st.Entries = []Entry{}
+	err := st.Open()
+	return st, err
+}
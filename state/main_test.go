@@ -0,0 +1,130 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	expected := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if checksum := Checksum([]byte("abc")); checksum != expected {
+		t.Errorf("Expected checksum '%s', got '%s'", expected, checksum)
+	}
+}
+
+func TestState_RecordAndGet(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	st, err := New(filepath.Join(tmpDir, "state.json"))
+	if err != nil {
+		t.Fatalf("Failed to create state: %v", err)
+	}
+
+	output := filepath.Join(tmpDir, "output.conf")
+	st.Record(output, "server.conf", "abc", "testuser")
+	st.Record(output, "server.conf", "def", "testuser2")
+
+	if len(st.Entries) != 1 {
+		t.Fatalf("Expected 1 entry after recording the same path twice, got %d", len(st.Entries))
+	}
+
+	entry, found := st.Get(output)
+	if !found {
+		t.Fatal("Expected entry to be found")
+	}
+	if entry.Checksum != "def" {
+		t.Errorf("Expected checksum 'def', got '%s'", entry.Checksum)
+	}
+	if entry.Engineer != "testuser2" {
+		t.Errorf("Expected engineer 'testuser2', got '%s'", entry.Engineer)
+	}
+
+	if !st.Remove(output) {
+		t.Error("Expected Remove to return true for recorded path")
+	}
+	if _, found := st.Get(output); found {
+		t.Error("Expected entry to be removed")
+	}
+}
+
+func TestState_Check(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	st, err := New(filepath.Join(tmpDir, "state.json"))
+	if err != nil {
+		t.Fatalf("Failed to create state: %v", err)
+	}
+
+	output := filepath.Join(tmpDir, "output.conf")
+	if err := os.WriteFile(output, []byte("rendered"), 0644); err != nil {
+		t.Fatalf("Failed to write output: %v", err)
+	}
+
+	status, err := st.Check(output)
+	if err != nil || status != StatusUntracked {
+		t.Errorf("Expected status '%s', got '%s' (%v)", StatusUntracked, status, err)
+	}
+
+	st.Record(output, "server.conf", Checksum([]byte("rendered")), "testuser")
+	status, err = st.Check(output)
+	if err != nil || status != StatusOK {
+		t.Errorf("Expected status '%s', got '%s' (%v)", StatusOK, status, err)
+	}
+
+	if err := os.WriteFile(output, []byte("hand edited"), 0644); err != nil {
+		t.Fatalf("Failed to modify output: %v", err)
+	}
+	status, err = st.Check(output)
+	if err != nil || status != StatusModified {
+		t.Errorf("Expected status '%s', got '%s' (%v)", StatusModified, status, err)
+	}
+
+	if err := os.Remove(output); err != nil {
+		t.Fatalf("Failed to remove output: %v", err)
+	}
+	status, err = st.Check(output)
+	if err != nil || status != StatusMissing {
+		t.Errorf("Expected status '%s', got '%s' (%v)", StatusMissing, status, err)
+	}
+}
+
+func TestState_SaveAndOpen(t *testing.T) {
+	tmpDir := t.TempDir()
+	statefile := filepath.Join(tmpDir, "nested", "state.json")
+
+	st1, err := New(statefile)
+	if err != nil {
+		t.Fatalf("Failed to create state: %v", err)
+	}
+	st1.Record(filepath.Join(tmpDir, "b.conf"), "b.tmpl", "bbb", "testuser")
+	st1.Record(filepath.Join(tmpDir, "a.conf"), "a.tmpl", "aaa", "testuser")
+
+	if err := st1.Save(); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	st2, err := New(statefile)
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	if len(st2.Entries) != 2 {
+		t.Fatalf("Expected 2 loaded entries, got %d", len(st2.Entries))
+	}
+	if st2.Entries[0].Template != "a.tmpl" {
+		t.Errorf("Expected entries sorted by path, got %v", st2.Entries)
+	}
+
+	// Saving fewer entries must not leave stale content behind
+	st2.Remove(filepath.Join(tmpDir, "b.conf"))
+	if err := st2.Save(); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+	st3, err := New(statefile)
+	if err != nil {
+		t.Fatalf("Failed to reload state: %v", err)
+	}
+	if len(st3.Entries) != 1 {
+		t.Errorf("Expected 1 entry after removal, got %d", len(st3.Entries))
+	}
+}
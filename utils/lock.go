@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// LockFile takes an exclusive lock on targetpath, creating the file when
+// needed, and waits until no other process or open file holds it. The
+// returned function releases the lock.
+func LockFile(targetpath string) (func(), error) {
+	LogStart()
+	defer LogEnd()
+
+	if err := MkdirAll(filepath.Dir(targetpath)); err != nil {
+		return nil, err
+	}
+
+	filehandle, err := os.OpenFile(targetpath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	if err := syscall.Flock(int(filehandle.Fd()), syscall.LOCK_EX); err != nil {
+		filehandle.Close()
+		return nil, fmt.Errorf("failed to lock %s: %w", targetpath, err)
+	}
+	Debugf("locked %s", targetpath)
+
+	return func() {
+		_ = syscall.Flock(int(filehandle.Fd()), syscall.LOCK_UN)
+		filehandle.Close()
+		Debugf("unlocked %s", targetpath)
+	}, nil
+}
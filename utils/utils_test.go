@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestMkdirAll(t *testing.T) {
@@ -73,3 +74,88 @@ func TestLogEnd(t *testing.T) {
 	// Test that LogEnd doesn't panic
 	LogEnd()
 }
+
+func TestWriteFileAtomic(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "nested", "scmt.env")
+
+	written, err := WriteFileAtomic(target, []byte("TYPE=server\n"), 0640)
+	if err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if !written {
+		t.Error("Expected a new file to be written")
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("Expected mode 0640, got %o", info.Mode().Perm())
+	}
+
+	// Unchanged content is not rewritten, but the permissions are fixed
+	if err := os.Chmod(target, 0600); err != nil {
+		t.Fatalf("Failed to chmod file: %v", err)
+	}
+	written, err = WriteFileAtomic(target, []byte("TYPE=server\n"), 0640)
+	if err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if written {
+		t.Error("Expected unchanged content not to be written")
+	}
+	if info, _ := os.Stat(target); info.Mode().Perm() != 0640 {
+		t.Errorf("Expected mode 0640, got %o", info.Mode().Perm())
+	}
+
+	written, err = WriteFileAtomic(target, []byte("TYPE=desktop\n"), 0640)
+	if err != nil || !written {
+		t.Fatalf("Expected changed content to be written, got %t, %v", written, err)
+	}
+	content, _ := os.ReadFile(target)
+	if string(content) != "TYPE=desktop\n" {
+		t.Errorf("Expected new content, got %q", content)
+	}
+
+	// No temporary files are left behind
+	entries, _ := os.ReadDir(filepath.Dir(target))
+	if len(entries) != 1 {
+		t.Errorf("Expected only the target file, got %d entries", len(entries))
+	}
+}
+
+func TestLockFile(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "data.json.lock")
+
+	unlock, err := LockFile(target)
+	if err != nil {
+		t.Fatalf("Failed to lock file: %v", err)
+	}
+
+	// A second lock waits until the first is released
+	locked := make(chan func())
+	go func() {
+		second, err := LockFile(target)
+		if err != nil {
+			t.Errorf("Failed to lock file: %v", err)
+		}
+		locked <- second
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("Expected the second lock to wait")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case second := <-locked:
+		if second != nil {
+			second()
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the second lock after release")
+	}
+}
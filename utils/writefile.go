@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic replaces targetpath with content through a temporary file
+// in the same directory, so readers never see a partially written file. The
+// file is left alone when it already holds content, apart from setting perm.
+// It returns true when the file was written.
+func WriteFileAtomic(targetpath string, content []byte, perm os.FileMode) (bool, error) {
+	LogStart()
+	defer LogEnd()
+
+	if current, err := os.ReadFile(targetpath); err == nil && bytes.Equal(current, content) {
+		Debugf("%s is unchanged", targetpath)
+		return false, os.Chmod(targetpath, perm)
+	}
+
+	directory := filepath.Dir(targetpath)
+	if err := MkdirAll(directory); err != nil {
+		return false, err
+	}
+
+	tmpfile, err := os.CreateTemp(directory, "."+filepath.Base(targetpath)+".*")
+	if err != nil {
+		return false, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmpfile.Name()) // Fails once renamed, which is fine
+
+	if _, err := tmpfile.Write(content); err != nil {
+		tmpfile.Close()
+		return false, fmt.Errorf("failed to write %s: %w", tmpfile.Name(), err)
+	}
+	if err := tmpfile.Chmod(perm); err != nil {
+		tmpfile.Close()
+		return false, fmt.Errorf("failed to set permissions of %s: %w", tmpfile.Name(), err)
+	}
+	if err := tmpfile.Sync(); err != nil {
+		tmpfile.Close()
+		return false, fmt.Errorf("failed to sync %s: %w", tmpfile.Name(), err)
+	}
+	if err := tmpfile.Close(); err != nil {
+		return false, err
+	}
+
+	if err := os.Rename(tmpfile.Name(), targetpath); err != nil {
+		return false, fmt.Errorf("failed to replace %s: %w", targetpath, err)
+	}
+	return true, nil
+}